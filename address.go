@@ -0,0 +1,90 @@
+package cc1101
+
+import (
+	"fmt"
+)
+
+// AddressFilter specifies how the packet handler filters
+// received packets by their address byte.
+type AddressFilter byte
+
+// Address filtering modes supported by the packet handler.
+const (
+	// AddressCheckNone disables address filtering.
+	// Packets have no address byte.
+	AddressCheckNone AddressFilter = PKTCTRL1_ADR_CHK_NONE
+
+	// AddressCheck accepts only packets sent to the radio's address.
+	AddressCheck AddressFilter = PKTCTRL1_ADR_CHK_NO_BROADCAST
+
+	// AddressCheckBroadcast also accepts packets sent to address 0x00.
+	AddressCheckBroadcast AddressFilter = PKTCTRL1_ADR_CHK_00_BROADCAST
+
+	// AddressCheckBroadcastFF also accepts packets sent to addresses 0x00 and 0xFF.
+	AddressCheckBroadcastFF AddressFilter = PKTCTRL1_ADR_CHK_00_FF_BROADCAST
+)
+
+// BroadcastAddress is the destination used by Send when address
+// filtering is enabled. It is accepted by the AddressCheckBroadcast
+// and AddressCheckBroadcastFF filters.
+const BroadcastAddress = 0x00
+
+func (f AddressFilter) String() string {
+	switch f {
+	case AddressCheckNone:
+		return "none"
+	case AddressCheck:
+		return "address"
+	case AddressCheckBroadcast:
+		return "address or 00 broadcast"
+	case AddressCheckBroadcastFF:
+		return "address or 00/FF broadcast"
+	default:
+		return fmt.Sprintf("AddressFilter(%d)", byte(f))
+	}
+}
+
+// SetAddress sets the radio's device address and address filtering mode.
+// When filtering is enabled, each packet carries a destination address
+// byte after the length byte (in variable-length mode) or at the start
+// of the packet (in fixed-length mode), which counts towards the
+// packet length, and the radio discards received packets that do not
+// pass the filter.
+// Address filtering is not supported for ZeroTerminated
+// or ExtendedLength packets.
+// SetPacketFormat and InitRF reset the filter to AddressCheckNone.
+func (r *Radio) SetAddress(addr byte, filter AddressFilter) {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return
+	}
+	if filter > AddressCheckBroadcastFF {
+		r.setError(fmt.Errorf("invalid address filter %v", filter))
+		return
+	}
+	if filter != AddressCheckNone && (r.packetFormat == ZeroTerminated || r.packetFormat == ExtendedLength) {
+		r.setError(fmt.Errorf("address filtering is not supported for %v packets", r.packetFormat))
+		return
+	}
+	p1 := r.hw.ReadRegister(PKTCTRL1)
+	r.hw.WriteRegister(PKTCTRL1, p1&^0x3|byte(filter))
+	r.hw.WriteRegister(ADDR, addr)
+	if r.error() != nil {
+		return
+	}
+	r.address = addr
+	r.addressFilter = filter
+}
+
+// Address returns the radio's device address and address filtering mode.
+func (r *Radio) Address() (byte, AddressFilter) {
+	r.hold()
+	defer r.release()
+	return r.address, r.addressFilter
+}
+
+// addressing reports whether packets carry an address byte.
+func (r *Radio) addressing() bool {
+	return r.addressFilter != AddressCheckNone
+}
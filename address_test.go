@@ -0,0 +1,135 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSetAddress(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetAddress(0x42, AddressCheck)
+	if r.Error() == nil {
+		t.Errorf("SetAddress with %v packets succeeded, want error", ZeroTerminated)
+	}
+	r.SetError(nil)
+	r.SetPacketFormat(VariableLength, 61, true)
+	r.SetAddress(0x42, AddressCheckBroadcastFF)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	rf := e.Configuration()
+	if rf.ADDR != 0x42 || rf.PKTCTRL1&0x3 != PKTCTRL1_ADR_CHK_00_FF_BROADCAST {
+		t.Errorf("ADDR, PKTCTRL1 == %02X %02X, want 42 with %v filter", rf.ADDR, rf.PKTCTRL1, AddressCheckBroadcastFF)
+	}
+	if rf.PKTCTRL1&PKTCTRL1_APPEND_STATUS == 0 {
+		t.Errorf("SetAddress cleared APPEND_STATUS")
+	}
+	addr, filter := r.Address()
+	if addr != 0x42 || filter != AddressCheckBroadcastFF {
+		t.Errorf("Address() == (%02X, %v), want (42, %v)", addr, filter, AddressCheckBroadcastFF)
+	}
+	r.SetPacketFormat(FixedLength, 20, false)
+	if _, filter = r.Address(); filter != AddressCheckNone || e.Configuration().PKTCTRL1&0x3 != 0 {
+		t.Errorf("SetPacketFormat did not reset address filter")
+	}
+	r.SetAddress(0x42, AddressFilter(4))
+	if r.Error() == nil {
+		t.Errorf("SetAddress with invalid filter succeeded, want error")
+	}
+}
+
+func TestSendTo(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	data := binaryPacket(10)
+
+	r.SetPacketFormat(VariableLength, 61, true)
+	r.SetAddress(0x42, AddressCheck)
+	r.SendTo(0x17, data)
+	want := append([]byte{byte(1 + len(data)), 0x17}, data...)
+	if sent := e.Transmitted(); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("transmitted % X, want % X", sent, want)
+	}
+	r.Send(data)
+	want[1] = BroadcastAddress
+	if sent := e.Transmitted(); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("transmitted % X, want % X", sent, want)
+	}
+
+	r.SetPacketFormat(FixedLength, 20, false)
+	r.SetAddress(0x42, AddressCheck)
+	r.SendTo(0x17, data)
+	want = resize(append([]byte{0x17}, data...), 20)
+	if sent := e.Transmitted(); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("transmitted % X, want % X", sent, want)
+	}
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+}
+
+func TestAddressFilter(t *testing.T) {
+	cases := []struct {
+		filter AddressFilter
+		dest   byte
+		ok     bool
+	}{
+		{AddressCheckNone, 0x17, true},
+		{AddressCheck, 0x42, true},
+		{AddressCheck, 0x17, false},
+		{AddressCheck, 0x00, false},
+		{AddressCheckBroadcast, 0x00, true},
+		{AddressCheckBroadcast, 0xFF, false},
+		{AddressCheckBroadcastFF, 0x00, true},
+		{AddressCheckBroadcastFF, 0xFF, true},
+		{AddressCheckBroadcastFF, 0x17, false},
+	}
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	data := binaryPacket(10)
+	for _, c := range cases {
+		r.SetPacketFormat(VariableLength, 61, true)
+		r.SetAddress(0x42, c.filter)
+		e.Inject(append([]byte{byte(1 + len(data)), c.dest}, data...))
+		p := r.ReceivePacket(50 * time.Millisecond)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if !c.ok {
+			if p.Data != nil {
+				t.Errorf("%v filter: received packet for %02X, want nothing", c.filter, c.dest)
+			}
+			continue
+		}
+		want := data
+		if c.filter == AddressCheckNone {
+			// Without filtering, the address is part of the payload.
+			want = append([]byte{c.dest}, data...)
+		}
+		if !bytes.Equal(p.Data, want) {
+			t.Errorf("%v filter: received % X, want % X", c.filter, p.Data, want)
+		}
+		if c.filter != AddressCheckNone && p.Address != c.dest {
+			t.Errorf("%v filter: received address %02X, want %02X", c.filter, p.Address, c.dest)
+		}
+	}
+}
+
+func TestFixedLengthAddress(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(FixedLength, 11, true)
+	r.SetAddress(0x42, AddressCheck)
+	data := binaryPacket(10)
+	e.Inject(append([]byte{0x17}, data...))
+	e.Inject(append([]byte{0x42}, data...))
+	p := r.ReceivePacket(time.Second)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if p.Address != 0x42 || !bytes.Equal(p.Data, data) {
+		t.Errorf("received % X for %02X, want % X for 42", p.Data, p.Address, data)
+	}
+}
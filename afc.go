@@ -0,0 +1,206 @@
+package cc1101
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrAFCNotSupported indicates that automatic frequency compensation
+// was requested with ASK/OOK modulation, for which the radio
+// does not estimate the frequency offset (FREQEST).
+var ErrAFCNotSupported = errors.New("AFC is not supported with ASK/OOK modulation")
+
+// AFCMode specifies how the radio compensates for the
+// frequency offset of received packets.
+type AFCMode byte
+
+// Automatic frequency compensation modes.
+const (
+	// AFCOff leaves FSCTRL0 unchanged.
+	AFCOff AFCMode = iota
+
+	// AFCAccumulate adds the frequency offset estimate (FREQEST)
+	// of each valid packet to FSCTRL0.
+	AFCAccumulate
+
+	// AFCStrobe issues the SAFC command after each valid packet,
+	// so that the radio adjusts FSCTRL0 itself.
+	AFCStrobe
+)
+
+func (m AFCMode) String() string {
+	switch m {
+	case AFCOff:
+		return "off"
+	case AFCAccumulate:
+		return "accumulate"
+	case AFCStrobe:
+		return "strobe"
+	default:
+		return fmt.Sprintf("AFCMode(%d)", byte(m))
+	}
+}
+
+// SetAFC sets the automatic frequency compensation mode.
+// Compensation is applied after each valid packet received by
+// Receive, ReceivePacket, ReceiveContext, SendAndReceive,
+// and ReceiveWakeOnRadio, but not while streaming.
+// It requires an FSK modulation format, since FREQEST is not valid
+// for ASK/OOK; InitRF selects OOK, so SetModulation must be called
+// first, or the error state is set to ErrAFCNotSupported.
+// InitRF turns compensation off and resets FSCTRL0
+// to the frequency offset in the radio's profile.
+func (r *Radio) SetAFC(mode AFCMode) {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return
+	}
+	if mode > AFCStrobe {
+		r.setError(fmt.Errorf("invalid AFC mode %v", mode))
+		return
+	}
+	if mode != AFCOff && !r.estimatesFrequency() {
+		r.setError(ErrAFCNotSupported)
+		return
+	}
+	r.afc = mode
+}
+
+// estimatesFrequency reports whether FREQEST is valid
+// for the current modulation format.
+func (r *Radio) estimatesFrequency() bool {
+	m2 := r.hw.ReadRegister(MDMCFG2)
+	return m2&MDMCFG2_MOD_FORMAT_MASK != MDMCFG2_MOD_FORMAT_ASK_OOK
+}
+
+// AFC returns the automatic frequency compensation mode.
+func (r *Radio) AFC() AFCMode {
+	r.hold()
+	defer r.release()
+	return r.afc
+}
+
+// trackFrequency applies automatic frequency compensation
+// after a valid packet has been received, in IDLE state.
+func (r *Radio) trackFrequency() {
+	if r.error() != nil {
+		return
+	}
+	if !r.estimatesFrequency() {
+		r.freqEst = 0
+		return
+	}
+	r.freqEst = int8(r.hw.ReadRegister(FREQEST))
+	switch r.afc {
+	case AFCAccumulate:
+		r.writeFrequencyOffset(int(int8(r.hw.ReadRegister(FSCTRL0))) + int(r.freqEst))
+	case AFCStrobe:
+		r.strobe(SAFC)
+	default:
+		return
+	}
+	r.freqEst = 0
+}
+
+func (r *Radio) writeFrequencyOffset(v int) {
+	if v < -128 {
+		v = -128
+	} else if v > 127 {
+		v = 127
+	}
+	r.hw.WriteRegister(FSCTRL0, byte(int8(v)))
+}
+
+// FrequencyOffset returns the frequency offset added to the synthesizer
+// frequency (FSCTRL0), in units of FXOSC/2^14 Hz.
+func (r *Radio) FrequencyOffset() int8 {
+	r.hold()
+	defer r.release()
+	return int8(r.hw.ReadRegister(FSCTRL0))
+}
+
+// SetFrequencyOffset sets the frequency offset added to the synthesizer
+// frequency (FSCTRL0), in units of FXOSC/2^14 Hz.
+func (r *Radio) SetFrequencyOffset(v int8) {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return
+	}
+	r.writeFrequencyOffset(int(v))
+	r.freqEst = 0
+}
+
+// FrequencyError returns the estimated frequency error of the radio
+// relative to the transmitters it has received from, in parts per million.
+// It is derived from the sum of the compensation in FSCTRL0 and the offset
+// of the last valid packet that has not been compensated for.
+// A positive offset means the transmitters are above the radio's frequency,
+// so the radio's error is negative; this is the same convention as
+// Profile.CrystalPPM.
+// Packets received with ASK/OOK modulation do not contribute to it.
+// It returns 0 if the radio's frequency has not been set.
+func (r *Radio) FrequencyError() float64 {
+	r.hold()
+	defer r.release()
+	v := int(int8(r.hw.ReadRegister(FSCTRL0))) + int(r.freqEst)
+	freq := r.frequency()
+	if r.error() != nil || freq == 0 {
+		return 0
+	}
+	hz := float64(v) * float64(r.fxosc) / (1 << 14)
+	return -hz / float64(freq) * 1e6
+}
+
+// SaveFrequencyOffset writes the frequency offset (FSCTRL0)
+// to the given file, so that it can be restored after a restart
+// by LoadFrequencyOffset.
+func (r *Radio) SaveFrequencyOffset(path string) error {
+	v := r.FrequencyOffset()
+	if err := r.Error(); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(strconv.Itoa(int(v))+"\n"))
+}
+
+// LoadFrequencyOffset sets the frequency offset (FSCTRL0)
+// from a file written by SaveFrequencyOffset.
+// It must be called after InitRF, which resets FSCTRL0.
+func (r *Radio) LoadFrequencyOffset(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 8)
+	if err != nil {
+		return fmt.Errorf("%s: invalid frequency offset: %v", path, err)
+	}
+	r.SetFrequencyOffset(int8(v))
+	return r.Error()
+}
+
+// writeFileAtomic writes data to a temporary file and renames it,
+// so that the file is not left incomplete if the program is interrupted.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package cc1101
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAFC(t *testing.T) {
+	const freq = 868300000
+	ppm := func(v int) float64 {
+		return float64(v) * FXOSC / (1 << 14) / freq * 1e6
+	}
+	receive := []struct {
+		name    string
+		format  PacketFormat
+		receive func(r *Radio) Packet
+	}{
+		{"ReceivePacket", VariableLength, func(r *Radio) Packet { return r.ReceivePacket(time.Second) }},
+		{"zero-terminated", ZeroTerminated, func(r *Radio) Packet { return r.ReceivePacket(time.Second) }},
+		{"ReceiveContext", VariableLength, func(r *Radio) Packet {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			p, _ := r.ReceiveContext(ctx)
+			return p
+		}},
+	}
+	for _, c := range receive {
+		for _, mode := range []AFCMode{AFCOff, AFCAccumulate, AFCStrobe} {
+			r, e := openEmulator(t)
+			r.InitRF(freq)
+			r.SetModulation(ModulationGFSK, 20000)
+			if c.format != ZeroTerminated {
+				r.SetPacketFormat(c.format, 61, true)
+			}
+			r.SetAFC(mode)
+			if r.AFC() != mode {
+				t.Errorf("AFC() == %v, want %v", r.AFC(), mode)
+			}
+			data := testPacket(20)
+			frame := append(data, 0)
+			if c.format == VariableLength {
+				frame = append([]byte{byte(len(data))}, data...)
+			}
+			for i, offset := range []int8{10, 12, -5} {
+				e.SetFREQEST(offset)
+				e.Inject(frame)
+				p := c.receive(r)
+				if r.Error() != nil {
+					t.Fatalf("%s, %v: %v", c.name, mode, r.Error())
+				}
+				if p.Data == nil {
+					t.Fatalf("%s, %v: no packet received", c.name, mode)
+				}
+				want := int8(0)
+				if mode != AFCOff {
+					want = offset
+				}
+				if v := r.FrequencyOffset(); v != want {
+					t.Errorf("%s, %v, packet %d: FSCTRL0 == %d, want %d", c.name, mode, i, v, want)
+				}
+				// The transmitter is above the radio, so the radio's error is negative.
+				if err := r.FrequencyError(); math.Abs(err+ppm(int(offset))) > 0.01 {
+					t.Errorf("%s, %v, packet %d: frequency error == %.2f ppm, want %.2f", c.name, mode, i, err, -ppm(int(offset)))
+				}
+			}
+		}
+	}
+}
+
+func TestAFCInvalidPacket(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetModulation(ModulationGFSK, 20000)
+	r.SetPacketFormat(VariableLength, 61, true)
+	r.SetAFC(AFCAccumulate)
+	e.SetFREQEST(10)
+	data := testPacket(20)
+	e.InjectCorrupted(append([]byte{byte(len(data))}, data...))
+	r.ReceivePacket(100 * time.Millisecond)
+	r.SetError(nil)
+	if v := r.FrequencyOffset(); v != 0 {
+		t.Errorf("FSCTRL0 == %d after invalid packet, want 0", v)
+	}
+	r.SetAFC(AFCMode(3))
+	if r.Error() == nil {
+		t.Errorf("SetAFC with invalid mode succeeded")
+	}
+}
+
+func TestAFCOOK(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetAFC(AFCAccumulate)
+	if r.Error() != ErrAFCNotSupported {
+		t.Errorf("SetAFC with OOK: error == %v, want %v", r.Error(), ErrAFCNotSupported)
+	}
+	r.SetError(nil)
+	r.SetAFC(AFCOff)
+	if r.Error() != nil {
+		t.Errorf("SetAFC(AFCOff) with OOK: %v", r.Error())
+	}
+	// FREQEST is ignored after switching to OOK.
+	r.SetModulation(ModulationGFSK, 20000)
+	r.SetAFC(AFCAccumulate)
+	r.SetModulation(ModulationOOK, 0)
+	e.SetFREQEST(10)
+	data := testPacket(20)
+	e.Inject(append(data, 0))
+	if p := r.ReceivePacket(time.Second); p.Data == nil {
+		t.Fatalf("no packet received: %v", r.Error())
+	}
+	if v, ppm := r.FrequencyOffset(), r.FrequencyError(); v != 0 || ppm != 0 {
+		t.Errorf("FSCTRL0, frequency error with OOK == %d, %.2f ppm, want 0, 0", v, ppm)
+	}
+	// The error is not defined without a frequency.
+	r.SetFrequencyOffset(10)
+	r.Backend().WriteBurst(FREQ2, []byte{0, 0, 0})
+	if ppm := r.FrequencyError(); ppm != 0 {
+		t.Errorf("frequency error with no frequency == %v, want 0", ppm)
+	}
+}
+
+func TestSaveFrequencyOffset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cc1101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "offset")
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetFrequencyOffset(-7)
+	if err := r.SaveFrequencyOffset(path); err != nil {
+		t.Fatal(err)
+	}
+	r.InitRF(868300000)
+	if v := r.FrequencyOffset(); v != 0 {
+		t.Errorf("FSCTRL0 == %d after InitRF, want 0", v)
+	}
+	if err := r.LoadFrequencyOffset(path); err != nil {
+		t.Fatal(err)
+	}
+	if c := e.Configuration(); int8(c.FSCTRL0) != -7 {
+		t.Errorf("FSCTRL0 == %d, want -7", int8(c.FSCTRL0))
+	}
+	if err := ioutil.WriteFile(path, []byte("200\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadFrequencyOffset(path); err == nil {
+		t.Errorf("loading out-of-range offset succeeded")
+	}
+	if err := r.LoadFrequencyOffset(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("loading missing file: %v", err)
+	}
+}
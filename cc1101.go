@@ -3,7 +3,8 @@ package cc1101
 // Register definitions for Texas Instruments CC1101.
 
 const (
-	// Crystal frequency in Hz.
+	// Default crystal frequency in Hz.
+	// See Radio.SetCrystalFrequency for other values.
 	FXOSC = 24000000
 
 	// SPI transaction header bits for read/write and burst/single access.
@@ -470,6 +471,13 @@ const (
 	AGCCTRL0_FILTER_LENGTH_32         = 2 << 0
 	AGCCTRL0_FILTER_LENGTH_64         = 3 << 0
 
+	WORCTRL_RC_PD         = 1 << 7
+	WORCTRL_EVENT1_MASK   = 7 << 4
+	WORCTRL_EVENT1_SHIFT  = 4
+	WORCTRL_RC_CAL        = 1 << 3
+	WORCTRL_WOR_RES_MASK  = 3 << 0
+	WORCTRL_WOR_RES_SHIFT = 0
+
 	FREND1_LNA_CURRENT_SHIFT          = 6
 	FREND1_LNA2MIX_CURRENT_SHIFT      = 4
 	FREND1_LODIV_BUF_CURRENT_RX_SHIFT = 2
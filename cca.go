@@ -0,0 +1,181 @@
+package cc1101
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// ErrChannelBusy indicates that the channel did not become clear
+// within the maximum wait given to SendWhenClear.
+var ErrChannelBusy = errors.New("channel busy")
+
+// Number of byte times allowed after entering RX state for the RSSI,
+// and therefore the clear channel assessment, to become valid.
+// The RSSI is averaged over a number of symbols,
+// so the time it takes to settle scales with the data rate.
+const carrierSenseBytes = 2
+
+// AGC magnitude target for each MAGN_TARGET value, in dB.
+var magnTarget = [...]int{24, 27, 30, 33, 36, 38, 40, 42}
+
+// Reduction from the maximum LNA gain for each MAX_LNA_GAIN value, in dB.
+var lnaGainReduction = [...]int{0, 3, 6, 7, 9, 12, 15, 17}
+
+// carrierSenseBase returns the approximate RSSI, in dBm,
+// at which carrier sense is asserted with CARRIER_SENSE_ABS_THR = 0,
+// for the given AGCCTRL2 value. It is derived from the typical values
+// in the data sheet for low data rates with all DVGA gain settings enabled.
+func carrierSenseBase(agcctrl2 byte) int {
+	return -121 + magnTarget[agcctrl2&0x7] + lnaGainReduction[(agcctrl2>>3)&0x7]
+}
+
+// carrierSenseThreshold returns the absolute carrier sense threshold,
+// in dBm, for the given AGCCTRL2 and AGCCTRL1 values,
+// and whether the absolute threshold is enabled.
+func carrierSenseThreshold(agcctrl2, agcctrl1 byte) (int, bool) {
+	abs := agcctrl1 & 0xF
+	if abs == AGCCTRL1_CARRIER_SENSE_ABS_THR_DISABLE {
+		return 0, false
+	}
+	// CARRIER_SENSE_ABS_THR is a 4-bit two's complement value.
+	return carrierSenseBase(agcctrl2) + int(int8(abs<<4)>>4), true
+}
+
+// Relative carrier sense thresholds, in dB,
+// for each CARRIER_SENSE_REL_THR value.
+var relativeThreshold = [...]int{0, 6, 10, 14}
+
+// SetCarrierSense sets the absolute carrier sense threshold in dBm,
+// and the relative threshold in dB (0 to disable it, or 6, 10 or 14),
+// used for clear channel assessment.
+// The absolute threshold can be set to within 7 dB of a level
+// determined by the AGC settings; it is only approximate,
+// and may need adjustment for a particular board.
+// It returns the achieved absolute threshold.
+func (r *Radio) SetCarrierSense(dBm int, relative int) int {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return 0
+	}
+	rel := -1
+	for i, v := range relativeThreshold {
+		if v == relative {
+			rel = i
+		}
+	}
+	if rel < 0 {
+		r.setError(fmt.Errorf("invalid relative carrier sense threshold (%d dB)", relative))
+		return 0
+	}
+	agc := r.hw.ReadBurst(AGCCTRL2, 2)
+	if r.error() != nil {
+		return 0
+	}
+	base := carrierSenseBase(agc[0]) + r.profile.RSSIOffset
+	offset := dBm - base
+	if offset < -7 || offset > 7 {
+		r.setError(fmt.Errorf("carrier sense threshold %d dBm is out of range (%d to %d dBm)", dBm, base-7, base+7))
+		return 0
+	}
+	agcctrl1 := agc[1]&AGCCTRL1_AGC_LNA_PRIORITY_1 | byte(rel)<<4 | byte(offset)&0xF
+	r.hw.WriteRegister(AGCCTRL1, agcctrl1)
+	return dBm
+}
+
+// SendWhenClear transmits the given packet using listen-before-talk.
+// It enters RX state and issues the STX command, which the radio
+// ignores unless the channel is clear according to MCSM1.CCA_MODE
+// and the carrier sense thresholds (see SetCarrierSense).
+// While the channel is busy, it waits for a random time of up to
+// backoff before trying again. If the packet has not been sent
+// within maxWait, it sets the error state to ErrChannelBusy.
+// If address filtering is enabled, the packet is sent to BroadcastAddress.
+func (r *Radio) SendWhenClear(data []byte, backoff, maxWait time.Duration) {
+	r.holdLong()
+	defer r.release()
+	if r.error() != nil || !r.checkSize(data) {
+		return
+	}
+	packet := r.frame(BroadcastAddress, data)
+	n := r.fillTXFIFO(packet)
+	if r.clearToSend(backoff, time.Now().Add(maxWait)) {
+		r.continueTX(packet[n:], n)
+		r.idleAfterTX()
+		return
+	}
+	r.changeState(SIDLE, STATE_IDLE)
+	r.strobe(SFTX)
+	if r.error() == nil {
+		r.setError(ErrChannelBusy)
+	}
+}
+
+// clearToSend tries to start a transmission from RX state,
+// backing off while the channel is busy.
+// It returns true if the radio entered TX state before the deadline.
+func (r *Radio) clearToSend(backoff time.Duration, deadline time.Time) bool {
+	senseTime := r.carrierSenseTime()
+	for r.error() == nil {
+		// A packet received while backing off leaves the radio
+		// in IDLE state (MCSM1.RXOFF_MODE), from which STX would
+		// transmit without CCA, so discard it and start afresh.
+		r.changeState(SIDLE, STATE_IDLE)
+		r.strobe(SFRX)
+		r.changeState(SRX, STATE_RX)
+		time.Sleep(senseTime)
+		if r.channelBusy() {
+			if !r.backOff(backoff, deadline) {
+				break
+			}
+			continue
+		}
+		r.strobe(STX)
+		s := r.readState()
+		for r.error() == nil && (s == STATE_CALIBRATE || s == STATE_SETTLING) {
+			s = r.readState()
+		}
+		if r.error() != nil {
+			break
+		}
+		// The radio stays in RX state if the channel is busy,
+		// or goes to IDLE if a packet has just been received.
+		if s == STATE_TX {
+			return true
+		}
+		if !r.backOff(backoff, deadline) {
+			break
+		}
+	}
+	return false
+}
+
+// carrierSenseTime returns the time to wait after entering RX state
+// before the clear channel assessment is valid, at the configured data rate.
+func (r *Radio) carrierSenseTime() time.Duration {
+	return carrierSenseBytes * r.byteTime()
+}
+
+// channelBusy reports whether the radio has left RX state
+// since clearToSend entered it, because a packet was received.
+func (r *Radio) channelBusy() bool {
+	return r.hw.ReadRegister(MARCSTATE)&MARCSTATE_MASK != MARCSTATE_RX
+}
+
+// backOff waits for a random time of up to backoff after finding
+// the channel busy. It returns false if the deadline has passed.
+func (r *Radio) backOff(backoff time.Duration, deadline time.Time) bool {
+	if verbose {
+		log.Printf("channel busy")
+	}
+	if !time.Now().Before(deadline) {
+		return false
+	}
+	if backoff > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(backoff))))
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSetCarrierSense(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	cases := []struct {
+		dBm      int
+		relative int
+		agcctrl1 byte
+	}{
+		{-83, 0, AGCCTRL1_CARRIER_SENSE_REL_THR_DISABLE | AGCCTRL1_CARRIER_SENSE_ABS_THR_0DB},
+		{-80, 6, AGCCTRL1_CARRIER_SENSE_REL_THR_6DB | AGCCTRL1_CARRIER_SENSE_ABS_THR_3DB_ABOVE},
+		{-90, 14, AGCCTRL1_CARRIER_SENSE_REL_THR_14DB | AGCCTRL1_CARRIER_SENSE_ABS_THR_7DB_BELOW},
+	}
+	for _, c := range cases {
+		achieved := r.SetCarrierSense(c.dBm, c.relative)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if achieved != c.dBm {
+			t.Errorf("SetCarrierSense(%d, %d) == %d, want %d", c.dBm, c.relative, achieved, c.dBm)
+		}
+		rf := e.Configuration()
+		if rf.AGCCTRL1 != c.agcctrl1 {
+			t.Errorf("SetCarrierSense(%d, %d): AGCCTRL1 == %02X, want %02X", c.dBm, c.relative, rf.AGCCTRL1, c.agcctrl1)
+		}
+		threshold, ok := carrierSenseThreshold(rf.AGCCTRL2, rf.AGCCTRL1)
+		if !ok || threshold != c.dBm {
+			t.Errorf("carrierSenseThreshold(%02X, %02X) == (%d, %v), want (%d, true)", rf.AGCCTRL2, rf.AGCCTRL1, threshold, ok, c.dBm)
+		}
+	}
+	invalid := [][2]int{{-91, 0}, {-75, 0}, {-83, 5}}
+	for _, c := range invalid {
+		r.SetError(nil)
+		r.SetCarrierSense(c[0], c[1])
+		if r.Error() == nil {
+			t.Errorf("SetCarrierSense(%d, %d) succeeded, want error", c[0], c[1])
+		}
+	}
+}
+
+func TestSendWhenClear(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 61, true)
+	r.SetCarrierSense(-80, 0)
+	data := binaryPacket(20)
+	want := append([]byte{byte(len(data))}, data...)
+
+	e.SetRSSI(-100)
+	r.SendWhenClear(data, time.Millisecond, 10*time.Millisecond)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if sent := e.Transmitted(); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("transmitted % X, want % X", sent, want)
+	}
+
+	e.SetRSSI(-60)
+	r.SendWhenClear(data, time.Millisecond, 10*time.Millisecond)
+	if r.Error() != ErrChannelBusy {
+		t.Errorf("SendWhenClear on busy channel: error == %v, want %v", r.Error(), ErrChannelBusy)
+	}
+	r.SetError(nil)
+	if sent := e.Transmitted(); len(sent) != 0 {
+		t.Errorf("transmitted % X on busy channel", sent)
+	}
+	if s, n := r.ReadState(), r.ReadNumTXBytes(); s != STATE_IDLE || n != 0 {
+		t.Errorf("state, TXBYTES after busy channel == %s, %d, want IDLE, 0", StateName(s), n)
+	}
+
+	// A packet received while backing off is discarded,
+	// and the next attempt starts from RX state.
+	e.SetRSSI(-100)
+	e.Inject(append([]byte{byte(len(data))}, data...))
+	e.StateTrace()
+	r.SendWhenClear(data, time.Millisecond, 100*time.Millisecond)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if sent := e.Transmitted(); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("transmitted % X, want % X", sent, want)
+	}
+	trace := e.StateTrace()
+	if n := len(trace); n < 3 || trace[n-3] != STATE_RX || trace[n-2] != STATE_TX {
+		t.Errorf("state trace == %v, want TX from RX", stateNames(trace))
+	}
+	if n := r.ReadNumRXBytes(); n != 0 {
+		t.Errorf("RXBYTES after SendWhenClear == %d, want 0", n)
+	}
+
+	// The channel becomes clear while backing off.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		e.SetRSSI(-100)
+	}()
+	r.SendWhenClear(data, 5*time.Millisecond, time.Second)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if sent := e.Transmitted(); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("transmitted % X, want % X", sent, want)
+	}
+}
+
+func TestCarrierSenseTime(t *testing.T) {
+	r, _ := openEmulator(t)
+	r.InitRF(868300000)
+	for _, baud := range []uint32{1200, 38400, 250000} {
+		achieved := r.SetDataRate(baud)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		want := carrierSenseBytes * (8 * time.Second / time.Duration(achieved))
+		if d := r.carrierSenseTime(); d != want {
+			t.Errorf("%d baud: carrierSenseTime() == %v, want %v", achieved, d, want)
+		}
+	}
+}
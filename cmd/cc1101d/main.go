@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/ecc1/cc1101"
+	"github.com/ecc1/cc1101/remote"
+	"github.com/ecc1/radio"
+)
+
+var socket = flag.String("s", defaultSocket(), "pathname of the server `socket`")
+
+func defaultSocket() string {
+	path := os.Getenv("CC1101D_SOCKET")
+	if path == "" {
+		path = remote.DefaultSocket
+	}
+	return path
+}
+
+func main() {
+	flag.Usage = func() {
+		log.Printf("Usage: %s [-s socket] frequency", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	frequency := getFrequency(flag.Arg(0))
+	r := cc1101.Open()
+	if r.Error() != nil {
+		log.Fatal(r.Error())
+	}
+	r.Init(frequency)
+	if r.Error() != nil {
+		log.Fatal(r.Error())
+	}
+	// Remove a socket left behind by a previous instance.
+	if err := os.Remove(*socket); err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+	l, err := net.Listen("unix", *socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := remote.NewServer(r)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		s.Close()
+	}()
+	log.Printf("serving %s radio on %s at %s MHz", r.Device(), *socket, radio.MegaHertz(frequency))
+	err = s.Serve(l)
+	r.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func getFrequency(s string) uint32 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if 300.0 <= f && f <= 928.0 {
+		return uint32(f * 1000000.0)
+	}
+	if 300000000.0 <= f && f <= 928000000.0 {
+		return uint32(f)
+	}
+	log.Fatalf("%s: invalid frequency", s)
+	panic("unreachable")
+}
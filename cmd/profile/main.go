@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecc1/cc1101"
+	"github.com/ecc1/radio"
+)
+
+var (
+	output  = flag.String("o", "", "profile `file` (default $"+cc1101.ProfileEnv+")")
+	count   = flag.Int("n", 10, "`number` of packets to measure")
+	timeout = flag.Duration("t", time.Minute, "maximum `time` to wait for each packet")
+	refRSSI = flag.Int("rssi", 0, "actual signal strength of the reference transmitter in `dBm`")
+	pa      = flag.Int("pa", -1, "PATABLE `value` for transmitting (0 for the InitRF default, -1 to keep the profile's value)")
+
+	modulation = flag.String("modulation", "GFSK", "modulation `format` of the reference transmitter: 2-FSK, GFSK, 4-FSK, or MSK")
+	deviation  = flag.Uint("deviation", 20000, "frequency `deviation` of the reference transmitter in Hz")
+	dataRate   = flag.Uint("rate", 0, "data `rate` of the reference transmitter in Baud (0 for the InitRF default)")
+)
+
+// The frequency offset estimate (FREQEST) is only valid for FSK formats,
+// so OOK cannot be used to measure the crystal error.
+var fskFormats = []cc1101.Modulation{
+	cc1101.Modulation2FSK,
+	cc1101.ModulationGFSK,
+	cc1101.Modulation4FSK,
+	cc1101.ModulationMSK,
+}
+
+func getModulation(s string) cc1101.Modulation {
+	for _, mod := range fskFormats {
+		if strings.EqualFold(s, mod.String()) {
+			return mod
+		}
+	}
+	log.Fatalf("%s: modulation must be 2-FSK, GFSK, 4-FSK, or MSK, since the frequency offset cannot be measured otherwise", s)
+	panic("unreachable")
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] frequency\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Measures packets from a reference transmitter and updates the radio's calibration profile.\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *count < 1 || *pa > 0xFF {
+		flag.Usage()
+		os.Exit(2)
+	}
+	mod := getModulation(*modulation)
+	frequency := getFrequency(flag.Arg(0))
+	opts, err := cc1101.EnvironmentOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output != "" {
+		opts.Profile = *output
+	}
+	if opts.Profile == "" {
+		log.Fatalf("no profile file specified with -o or $%s", cc1101.ProfileEnv)
+	}
+	// The existing profile, if any, is applied when the radio is opened,
+	// so the measurements are residual errors.
+	r := cc1101.OpenWith(opts)
+	if r.Error() != nil {
+		log.Fatal(r.Error())
+	}
+	p, err := calibrate(r, frequency, mod)
+	r.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cc1101.SaveProfile(opts.Profile, r.Device(), p); err != nil {
+		log.Fatal(err)
+	}
+	// The frequency offset (FSCTRL0) is kept from the existing profile,
+	// since the measured offset is attributed to the crystal.
+	fmt.Printf("%s: %s\n", r.Device(), opts.Profile)
+	fmt.Printf("  crystal error     %+.2f ppm\n", p.CrystalPPM)
+	fmt.Printf("  PA                %02X\n", p.PA)
+	fmt.Printf("  RSSI offset       %+d dB\n", p.RSSIOffset)
+}
+
+// calibrate configures the radio for the reference transmitter, measures
+// its packets, and returns the radio's profile updated accordingly.
+func calibrate(r *cc1101.Radio, frequency uint32, mod cc1101.Modulation) (cc1101.Profile, error) {
+	r.Init(frequency)
+	r.SetModulation(mod, uint32(*deviation))
+	if *dataRate != 0 {
+		r.SetDataRate(uint32(*dataRate))
+	}
+	if r.Error() != nil {
+		return cc1101.Profile{}, r.Error()
+	}
+	p := r.Profile()
+	offset, rssi, err := measure(r)
+	if err != nil {
+		return p, err
+	}
+	// A positive offset means the transmitter is above the radio,
+	// so the radio's crystal is slow.
+	p.CrystalPPM -= offset / float64(frequency) * 1e6
+	if isSet("rssi") {
+		p.RSSIOffset += int(math.Round(float64(*refRSSI) - rssi))
+	}
+	if *pa >= 0 {
+		p.PA = byte(*pa)
+	}
+	return p, nil
+}
+
+// measure receives packets from the reference transmitter and returns
+// their average frequency offset in Hz and average RSSI in dBm.
+func measure(r *cc1101.Radio) (float64, float64, error) {
+	offset, rssi := 0, 0
+	for n := 0; n < *count; {
+		p := r.ReceivePacket(*timeout)
+		if r.Error() != nil {
+			return 0, 0, r.Error()
+		}
+		if p.Data == nil {
+			return 0, 0, fmt.Errorf("no packet received after %v", *timeout)
+		}
+		n++
+		log.Printf("packet %d: offset = %d Hz, RSSI = %d dBm", n, p.FrequencyOffset, p.RSSI)
+		offset += p.FrequencyOffset
+		rssi += p.RSSI
+	}
+	return float64(offset) / float64(*count), float64(rssi) / float64(*count), nil
+}
+
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func getFrequency(s string) uint32 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if f < 1000 {
+		f *= 1e6
+	}
+	if f < 300e6 || f > 928e6 {
+		log.Fatalf("%s: invalid frequency", s)
+	}
+	log.Printf("measuring at %s MHz", radio.MegaHertz(uint32(f)))
+	return uint32(f)
+}
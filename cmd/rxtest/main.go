@@ -22,8 +22,8 @@ func main() {
 	log.Printf("setting frequency to %d", frequency)
 	r.Init(frequency)
 	for r.Error() == nil {
-		data, rssi := r.Receive(time.Hour)
-		log.Printf("% X (RSSI = %d)", data, rssi)
+		p := r.ReceivePacket(time.Hour)
+		log.Printf("% X (RSSI = %d, LQI = %d, offset = %d Hz)", p.Data, p.RSSI, p.LQI, p.FrequencyOffset)
 	}
 	log.Fatal(r.Error())
 }
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ecc1/cc1101"
+	"github.com/ecc1/radio"
+)
+
+var (
+	start     = flag.Float64("start", 902, "start `frequency` in MHz")
+	stop      = flag.Float64("stop", 928, "stop `frequency` in MHz")
+	step      = flag.Float64("step", 250, "frequency `step` in kHz")
+	dwell     = flag.Duration("dwell", 10*time.Millisecond, "`time` to sample RSSI at each frequency")
+	samples   = flag.Int("samples", 10, "`number` of RSSI samples averaged at each frequency")
+	sweeps    = flag.Int("sweeps", 1, "`number` of sweeps to average and peak-hold over")
+	csvFormat = flag.Bool("csv", false, "print results as CSV")
+	waterfall = flag.Bool("waterfall", false, "sweep continuously, printing one line per sweep")
+	minDBm    = flag.Int("min", -110, "RSSI `dBm` shown as blank in waterfall mode")
+	maxDBm    = flag.Int("max", -40, "RSSI `dBm` shown as full in waterfall mode")
+)
+
+// Time for the receiver to settle after entering RX state,
+// before RSSI samples are valid.
+const settleTime = time.Millisecond
+
+// Characters used in waterfall mode, in order of increasing RSSI.
+const shades = " .:-=+*#%@"
+
+// Frequency range of the CC1101, in MHz.
+const (
+	minFrequency = 300
+	maxFrequency = 928
+)
+
+func main() {
+	flag.Parse()
+	if err := checkFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	freqs := frequencies(uint32(*start*1e6), uint32(*stop*1e6), uint32(math.Min(*step*1e3, maxFrequency*1e6)))
+	r := cc1101.Open()
+	if r.Error() != nil {
+		log.Fatal(r.Error())
+	}
+	r.Init(freqs[0])
+	if r.Error() != nil {
+		log.Fatal(r.Error())
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	s := newScan(len(freqs))
+	if *waterfall {
+		fmt.Printf("%-8s  %s MHz .. %s MHz\n", "", radio.MegaHertz(freqs[0]), radio.MegaHertz(freqs[len(freqs)-1]))
+	}
+	for n := 0; *waterfall || n < *sweeps; n++ {
+		sweep := make([]float64, len(freqs))
+		for i, f := range freqs {
+			select {
+			case <-interrupt:
+				idle(r)
+				r.Close()
+				os.Exit(1)
+			default:
+			}
+			avg, peak := measure(r, f)
+			if r.Error() != nil {
+				log.Fatal(r.Error())
+			}
+			sweep[i] = avg
+			s.add(i, avg, peak)
+		}
+		if *waterfall {
+			printWaterfall(sweep)
+		}
+	}
+	idle(r)
+	r.Close()
+	if *csvFormat {
+		printCSV(freqs, s)
+	} else {
+		printTable(freqs, s)
+	}
+}
+
+func checkFlags() error {
+	switch {
+	case flag.NArg() != 0:
+		return fmt.Errorf("unexpected arguments: %v", flag.Args())
+	case !(*step*1e3 >= 1):
+		return fmt.Errorf("step must be at least 1 Hz")
+	case !(*start >= minFrequency && *stop <= maxFrequency):
+		return fmt.Errorf("frequencies must be between %d and %d MHz", minFrequency, maxFrequency)
+	case !(*stop >= *start):
+		return fmt.Errorf("stop frequency is below start frequency")
+	case *stop > *start && *step*1e3 > (*stop-*start)*1e6:
+		// Checked as floats, since the step may not fit in a uint32.
+		return fmt.Errorf("step is larger than the frequency range")
+	case *samples < 1 || *sweeps < 1:
+		return fmt.Errorf("samples and sweeps must be at least 1")
+	case *minDBm >= *maxDBm:
+		return fmt.Errorf("min must be less than max")
+	}
+	return nil
+}
+
+func frequencies(start, stop, step uint32) []uint32 {
+	var freqs []uint32
+	// Stop before f += step could pass stop, or wrap around.
+	for f := start; ; f += step {
+		freqs = append(freqs, f)
+		if stop-f < step {
+			return freqs
+		}
+	}
+}
+
+// measure tunes to the given frequency, samples RSSI in RX state,
+// and returns the average and peak RSSI in dBm.
+func measure(r *cc1101.Radio, freq uint32) (float64, float64) {
+	idle(r)
+	r.SetFrequency(freq)
+	r.Strobe(cc1101.SRX)
+	time.Sleep(settleTime)
+	interval := *dwell / time.Duration(*samples)
+	power := 0.0
+	peak := math.Inf(-1)
+	for i := 0; i < *samples; i++ {
+		if i != 0 {
+			time.Sleep(interval)
+		}
+		dBm := float64(r.ReadRSSI())
+		power += fromDBm(dBm)
+		peak = math.Max(peak, dBm)
+	}
+	return toDBm(power / float64(*samples)), peak
+}
+
+// idle puts the radio in IDLE state, so that it can be retuned.
+func idle(r *cc1101.Radio) {
+	for r.Error() == nil && r.ReadState() != cc1101.STATE_IDLE {
+		r.Strobe(cc1101.SIDLE)
+	}
+}
+
+// RSSI values are averaged as power, not as dBm.
+func fromDBm(dBm float64) float64 {
+	return math.Pow(10, dBm/10)
+}
+
+func toDBm(mW float64) float64 {
+	return 10 * math.Log10(mW)
+}
+
+// scan accumulates the results of successive sweeps.
+type scan struct {
+	power []float64 // sum of average power at each frequency
+	peak  []float64 // peak RSSI in dBm at each frequency
+	count int
+	n     int // number of frequencies
+}
+
+func newScan(n int) *scan {
+	s := &scan{power: make([]float64, n), peak: make([]float64, n), n: n}
+	for i := range s.peak {
+		s.peak[i] = math.Inf(-1)
+	}
+	return s
+}
+
+func (s *scan) add(i int, avg, peak float64) {
+	s.power[i] += fromDBm(avg)
+	s.peak[i] = math.Max(s.peak[i], peak)
+	if i == s.n-1 {
+		s.count++
+	}
+}
+
+func (s *scan) average(i int) float64 {
+	return toDBm(s.power[i] / float64(s.count))
+}
+
+func printTable(freqs []uint32, s *scan) {
+	fmt.Printf("%-11s  %10s  %10s\n", "Freq (MHz)", "Avg (dBm)", "Peak (dBm)")
+	for i, f := range freqs {
+		fmt.Printf("%-11s  %10.1f  %10.0f\n", radio.MegaHertz(f), s.average(i), s.peak[i])
+	}
+}
+
+func printCSV(freqs []uint32, s *scan) {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"frequency_hz", "avg_dbm", "peak_dbm"})
+	for i, f := range freqs {
+		w.Write([]string{
+			fmt.Sprint(f),
+			fmt.Sprintf("%.1f", s.average(i)),
+			fmt.Sprintf("%.0f", s.peak[i]),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printWaterfall(sweep []float64) {
+	var b strings.Builder
+	for _, dBm := range sweep {
+		b.WriteByte(shade(dBm))
+	}
+	fmt.Printf("%s  |%s|\n", time.Now().Format("15:04:05"), b.String())
+}
+
+func shade(dBm float64) byte {
+	lo, hi := float64(*minDBm), float64(*maxDBm)
+	i := int((dBm - lo) / (hi - lo) * float64(len(shades)))
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(shades) {
+		i = len(shades) - 1
+	}
+	return shades[i]
+}
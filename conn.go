@@ -0,0 +1,230 @@
+package cc1101
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Addr is the address of a radio, as set by SetAddress.
+// It implements net.Addr.
+type Addr byte
+
+// Network returns the name of the network.
+func (Addr) Network() string {
+	return "cc1101"
+}
+
+func (a Addr) String() string {
+	return fmt.Sprintf("%02X", byte(a))
+}
+
+var errConnClosed = errors.New("use of closed radio connection")
+
+// timeoutError is returned by PacketConn operations whose deadline has passed.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// PacketConn implements net.PacketConn on top of a Radio,
+// using the packet handler's address filtering.
+// Each datagram is sent as one packet, addressed to the destination
+// and carrying the sender's address as the first byte of its payload,
+// so that ReadFrom can return an address to which replies can be sent.
+//
+// The radio is half-duplex: a pending ReadFrom is interrupted
+// while WriteTo transmits, and then resumes listening.
+// The PacketConn should be the radio's only user while it is open.
+type PacketConn struct {
+	r     *Radio
+	local Addr
+
+	mu            sync.Mutex
+	cond          sync.Cond
+	wake          chan struct{} // closed to interrupt a pending ReadFrom
+	writers       int
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+var _ net.PacketConn = (*PacketConn)(nil)
+
+// NewPacketConn returns a PacketConn that uses the given radio.
+// Address filtering must have been enabled with SetAddress.
+func NewPacketConn(r *Radio) (*PacketConn, error) {
+	if err := r.Error(); err != nil {
+		return nil, err
+	}
+	addr, filter := r.Address()
+	if filter == AddressCheckNone {
+		return nil, errors.New("radio address filtering is not enabled")
+	}
+	c := &PacketConn{r: r, local: Addr(addr), wake: make(chan struct{})}
+	c.cond.L = &c.mu
+	return c, nil
+}
+
+// ReadFrom waits for a packet until the read deadline, if any,
+// and copies its payload into p.
+// It returns the number of bytes copied and the sender's address.
+// If p is too small, the rest of the payload is discarded.
+func (c *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		for c.writers != 0 && !c.closed {
+			c.cond.Wait()
+		}
+		closed := c.closed
+		deadline := c.readDeadline
+		wake := c.wake
+		c.mu.Unlock()
+		if closed {
+			return 0, nil, c.opError("read", nil, errConnClosed)
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return 0, nil, c.opError("read", nil, timeoutError{})
+		}
+		ctx, cancel := c.readContext(deadline)
+		go func() {
+			select {
+			case <-wake:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		packet, err := c.r.ReceiveContext(ctx)
+		cancel()
+		switch err {
+		case nil:
+		case context.Canceled, context.DeadlineExceeded:
+			// Check for a new deadline, a writer, or Close.
+			continue
+		case ErrRXFIFOOverflow:
+			// The packet was lost.
+			c.r.SetError(nil)
+			continue
+		default:
+			c.r.SetError(nil)
+			return 0, nil, c.opError("read", nil, err)
+		}
+		if len(packet.Data) == 0 {
+			// No sender address.
+			continue
+		}
+		n := copy(p, packet.Data[1:])
+		return n, Addr(packet.Data[0]), nil
+	}
+}
+
+func (c *PacketConn) readContext(deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithDeadline(context.Background(), deadline)
+}
+
+// WriteTo sends p to the radio with the given address,
+// which must be an Addr.
+// The write deadline is checked before transmitting, but a transmission
+// that has started is not interrupted.
+func (c *PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	dst, ok := addr.(Addr)
+	if !ok {
+		return 0, c.opError("write", addr, fmt.Errorf("invalid address %v", addr))
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, c.opError("write", addr, errConnClosed)
+	}
+	deadline := c.writeDeadline
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		c.mu.Unlock()
+		return 0, c.opError("write", addr, timeoutError{})
+	}
+	c.writers++
+	c.interrupt()
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.writers--
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}()
+	c.r.SendTo(byte(dst), append([]byte{byte(c.local)}, p...))
+	if err := c.r.Error(); err != nil {
+		c.r.SetError(nil)
+		return 0, c.opError("write", addr, err)
+	}
+	return len(p), nil
+}
+
+// interrupt wakes a pending ReadFrom. c.mu must be held.
+func (c *PacketConn) interrupt() {
+	close(c.wake)
+	c.wake = make(chan struct{})
+}
+
+func (c *PacketConn) opError(op string, addr net.Addr, err error) error {
+	return &net.OpError{Op: op, Net: c.local.Network(), Source: c.local, Addr: addr, Err: err}
+}
+
+// Close interrupts any pending ReadFrom and leaves the radio in IDLE state.
+// It does not close the radio.
+func (c *PacketConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.opError("close", nil, errConnClosed)
+	}
+	c.closed = true
+	c.interrupt()
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	r := c.r
+	r.hold()
+	defer r.release()
+	r.changeState(SIDLE, STATE_IDLE)
+	return r.error()
+}
+
+// LocalAddr returns the radio's address.
+func (c *PacketConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.interrupt()
+	return nil
+}
+
+// SetReadDeadline sets the deadline for ReadFrom,
+// including a call that is already waiting.
+// A zero value means ReadFrom will not time out.
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.interrupt()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for WriteTo.
+// A zero value means WriteTo will not time out.
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
@@ -0,0 +1,161 @@
+package cc1101
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func openPacketConn(t *testing.T) (*PacketConn, *Radio, *Emulator) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 61, true)
+	if _, err := NewPacketConn(r); err == nil {
+		t.Errorf("NewPacketConn without address filtering succeeded")
+	}
+	r.SetAddress(0x42, AddressCheckBroadcast)
+	c, err := NewPacketConn(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, r, e
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func TestPacketConn(t *testing.T) {
+	c, r, e := openPacketConn(t)
+	if a := c.LocalAddr(); a != Addr(0x42) || a.String() != "42" {
+		t.Errorf("LocalAddr() == %v, want 42", a)
+	}
+	data := []byte("request")
+	n, err := c.WriteTo(data, Addr(0x17))
+	if err != nil || n != len(data) {
+		t.Fatalf("WriteTo returned (%d, %v)", n, err)
+	}
+	want := append([]byte{byte(2 + len(data)), 0x17, 0x42}, data...)
+	if sent := e.Transmitted(); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("transmitted % X, want % X", sent, want)
+	}
+	response := []byte("response")
+	e.Inject(append([]byte{byte(2 + len(response)), 0x42, 0x17}, response...))
+	buf := make([]byte, 100)
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	n, addr, err := c.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != Addr(0x17) || !bytes.Equal(buf[:n], response) {
+		t.Errorf("ReadFrom returned %q from %v, want %q from 17", buf[:n], addr, response)
+	}
+	// Packets for other addresses are filtered out.
+	e.Inject([]byte{3, 0x43, 0x17, 0xFF})
+	c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, _, err := c.ReadFrom(buf); !isTimeout(err) {
+		t.Errorf("ReadFrom error == %v, want timeout", err)
+	}
+	if _, err := c.WriteTo(make([]byte, 61), Addr(0x17)); err == nil {
+		t.Errorf("WriteTo with oversize packet succeeded")
+	}
+	if r.Error() != nil {
+		t.Errorf("radio error == %v after WriteTo failed", r.Error())
+	}
+	if _, err := c.WriteTo(data, &net.UDPAddr{}); err == nil {
+		t.Errorf("WriteTo with UDP address succeeded")
+	}
+	c.SetWriteDeadline(time.Now().Add(-time.Second))
+	if _, err := c.WriteTo(data, Addr(0x17)); !isTimeout(err) {
+		t.Errorf("WriteTo error == %v, want timeout", err)
+	}
+}
+
+func TestPacketConnDeadlines(t *testing.T) {
+	c, _, _ := openPacketConn(t)
+	buf := make([]byte, 100)
+	c.SetReadDeadline(time.Now().Add(-time.Second))
+	if _, _, err := c.ReadFrom(buf); !isTimeout(err) {
+		t.Errorf("ReadFrom error == %v, want timeout", err)
+	}
+	// A new deadline applies to a pending ReadFrom.
+	c.SetReadDeadline(time.Time{})
+	done := make(chan error)
+	go func() {
+		_, _, err := c.ReadFrom(buf)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	c.SetReadDeadline(start.Add(20 * time.Millisecond))
+	if err := <-done; !isTimeout(err) {
+		t.Errorf("ReadFrom error == %v, want timeout", err)
+	}
+	if d := time.Since(start); d > 200*time.Millisecond {
+		t.Errorf("ReadFrom took %v after deadline was set", d)
+	}
+}
+
+func TestPacketConnWriteDuringRead(t *testing.T) {
+	c, _, e := openPacketConn(t)
+	got := make(chan []byte)
+	go func() {
+		buf := make([]byte, 100)
+		n, _, _ := c.ReadFrom(buf)
+		got <- buf[:n]
+	}()
+	time.Sleep(20 * time.Millisecond)
+	written := make(chan error)
+	go func() {
+		_, err := c.WriteTo([]byte("hello"), Addr(0x17))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WriteTo blocked by pending ReadFrom")
+	}
+	if sent := e.Transmitted(); len(sent) != 1 {
+		t.Errorf("transmitted %d packets, want 1", len(sent))
+	}
+	// The pending ReadFrom resumes listening.
+	e.Inject([]byte{4, 0x00, 0x17, 'h', 'i'})
+	if p := <-got; string(p) != "hi" {
+		t.Errorf("received %q, want \"hi\"", p)
+	}
+}
+
+func TestPacketConnClose(t *testing.T) {
+	c, r, _ := openPacketConn(t)
+	done := make(chan error)
+	go func() {
+		_, _, err := c.ReadFrom(make([]byte, 100))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("ReadFrom succeeded after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not interrupt ReadFrom")
+	}
+	if s := r.ReadState(); s != STATE_IDLE {
+		t.Errorf("state == %s, want IDLE", StateName(s))
+	}
+	if c.Close() == nil {
+		t.Errorf("second Close succeeded")
+	}
+	if _, err := c.WriteTo([]byte("x"), Addr(0x17)); err == nil {
+		t.Errorf("WriteTo succeeded after Close")
+	}
+}
@@ -2,7 +2,10 @@ package cc1101
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/ecc1/radio"
 )
@@ -11,26 +14,28 @@ const (
 	hwVersion = 0x0014
 )
 
-type hwFlavor struct{}
+type hwFlavor struct {
+	opts Options
+}
 
 // SPIDevice returns the pathname of the radio's SPI device.
-func (hwFlavor) SPIDevice() string {
-	return spiDevice
+func (f hwFlavor) SPIDevice() string {
+	return f.opts.SPIDevice
 }
 
 // Speed returns the radio's SPI speed.
-func (hwFlavor) Speed() int {
-	return spiSpeed
+func (f hwFlavor) Speed() int {
+	return f.opts.Speed
 }
 
 // CustomCS returns the GPIO pin number to use as a custom chip-select for the radio.
-func (hwFlavor) CustomCS() int {
-	return customCS
+func (f hwFlavor) CustomCS() int {
+	return f.opts.CustomCS
 }
 
 // InterruptPin returns the GPIO pin number to use for receive interrupts.
-func (hwFlavor) InterruptPin() int {
-	return interruptPin
+func (f hwFlavor) InterruptPin() int {
+	return f.opts.InterruptPin
 }
 
 // ReadSingleAddress returns the encoding of an address for SPI read operations.
@@ -39,12 +44,23 @@ func (hwFlavor) ReadSingleAddress(addr byte) byte {
 }
 
 // ReadBurstAddress returns the encoding of an address for SPI burst-read operations.
+// The address must have been validated with checkBurstAddress.
 func (hwFlavor) ReadBurstAddress(addr byte) byte {
+	return READ_MODE | BURST_MODE | addr
+}
+
+// ErrNoBurstAccess indicates an attempt to read a status register
+// in burst mode, which the CC1101 does not support.
+var ErrNoBurstAccess = errors.New("no burst access for status registers")
+
+// checkBurstAddress returns an error if the given address
+// cannot be read in burst mode.
+func checkBurstAddress(addr byte) error {
 	reg := addr & 0x3F
 	if 0x30 <= reg && reg <= 0x3D {
-		log.Panicf("no burst access for CC1101 status register %02X", reg)
+		return fmt.Errorf("%w (%02X)", ErrNoBurstAccess, reg)
 	}
-	return READ_MODE | BURST_MODE | addr
+	return nil
 }
 
 // WriteSingleAddress returns the (identity) encoding of an address for SPI write operations.
@@ -57,40 +73,244 @@ func (hwFlavor) WriteBurstAddress(addr byte) byte {
 	return BURST_MODE | addr
 }
 
+// Hardware is the interface satisfied by the device underlying a Radio:
+// either an SPI-attached CC1101 module or an Emulator.
+type Hardware interface {
+	Device() string
+	Close()
+
+	ReadRegister(addr byte) byte
+	ReadBurst(addr byte, n int) []byte
+	WriteRegister(addr byte, value byte)
+	WriteBurst(addr byte, data []byte)
+
+	// Transfer performs a raw SPI transfer (send and receive).
+	Transfer(snd, rcv []byte) error
+
+	AwaitInterrupt(timeout time.Duration)
+	ReadInterrupt() bool
+
+	Error() error
+	SetError(error)
+}
+
+// errNotOpen is reported by operations on an SPI device that could not be opened.
+var errNotOpen = errors.New("radio device is not open")
+
+// spiHardware adapts radio.Hardware to the Hardware interface.
+// Operations on an SPI device that could not be opened
+// report an error instead of panicking.
+type spiHardware struct {
+	*radio.Hardware
+	device string // SPI device pathname
+	failed bool   // the device could not be opened
+}
+
+// openSPI opens the SPI device and records whether it failed.
+func openSPI(opts Options) spiHardware {
+	h := spiHardware{Hardware: radio.Open(hwFlavor{opts: opts}), device: opts.SPIDevice}
+	h.failed = h.Error() != nil || !opened(h.Hardware)
+	if h.failed && h.Error() == nil {
+		h.SetError(errNotOpen)
+	}
+	return h
+}
+
+// opened reports whether radio.Open completed.
+// If setting the SPI speed or the interrupt pin fails,
+// radio.Open closes the SPI device and records the result of Close
+// in place of the original error, so the error state alone is not enough.
+// A partially opened Hardware has no transfer buffers,
+// so reading a register panics before any I/O is attempted.
+func opened(h *radio.Hardware) (ok bool) {
+	if h.SPIDevice() == nil {
+		return false
+	}
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	h.ReadRegister(VERSION)
+	return true
+}
+
+// notOpen reports whether the SPI device could not be opened,
+// setting the error state if it is not already set.
+func (h spiHardware) notOpen() bool {
+	if !h.failed {
+		return false
+	}
+	if h.Error() == nil {
+		h.SetError(errNotOpen)
+	}
+	return true
+}
+
+// Device returns the pathname of the radio's SPI device.
+func (h spiHardware) Device() string {
+	return h.device
+}
+
+// Close closes the radio device.
+func (h spiHardware) Close() {
+	if h.failed {
+		return
+	}
+	h.Hardware.Close()
+}
+
+// ReadRegister reads the given address on the radio device.
+func (h spiHardware) ReadRegister(addr byte) byte {
+	if h.notOpen() {
+		return 0
+	}
+	return h.Hardware.ReadRegister(addr)
+}
+
+// ReadBurst reads a burst of n bytes from the given address on the radio device.
+func (h spiHardware) ReadBurst(addr byte, n int) []byte {
+	if h.notOpen() || h.Error() != nil {
+		return nil
+	}
+	if err := checkBurstAddress(addr); err != nil {
+		h.SetError(err)
+		return nil
+	}
+	return h.Hardware.ReadBurst(addr, n)
+}
+
+// WriteRegister writes the given value to the given address on the radio device.
+func (h spiHardware) WriteRegister(addr byte, value byte) {
+	if h.notOpen() {
+		return
+	}
+	h.Hardware.WriteRegister(addr, value)
+}
+
+// WriteBurst writes data in burst mode to the given address on the radio device.
+func (h spiHardware) WriteBurst(addr byte, data []byte) {
+	if h.notOpen() {
+		return
+	}
+	h.Hardware.WriteBurst(addr, data)
+}
+
+// Transfer performs a raw SPI transfer on the radio's SPI device.
+func (h spiHardware) Transfer(snd, rcv []byte) error {
+	if h.notOpen() {
+		return h.Error()
+	}
+	return h.SPIDevice().Transfer(snd, rcv)
+}
+
+// AwaitInterrupt waits with the given timeout for a receive interrupt.
+func (h spiHardware) AwaitInterrupt(timeout time.Duration) {
+	if h.notOpen() {
+		return
+	}
+	h.Hardware.AwaitInterrupt(timeout)
+}
+
+// ReadInterrupt returns the state of the receive interrupt.
+func (h spiHardware) ReadInterrupt() bool {
+	if h.notOpen() {
+		return false
+	}
+	return h.Hardware.ReadInterrupt()
+}
+
 // Radio represents an open radio device.
 type Radio struct {
-	hw            *radio.Hardware
+	hw            Hardware
 	receiveBuffer bytes.Buffer
 	snd           []byte
 	rcv           []byte
 	err           error
+	fxosc         uint32
+	packetFormat  PacketFormat
+	packetLength  int
+	crc           bool
+	address       byte
+	addressFilter AddressFilter
+	wor           WakeOnRadio
+	worRXTime     byte
+	sleeping      bool
+	fixedTX       bool // sending a ZeroTerminated packet with a known length
+	lengthSwitch  bool // switch to fixed-length mode near the end of the packet
+	shadow        RFConfiguration
+	shadowPATable []byte
+	fscal         map[byte]fscal // cached calibration results, if hopping
+	autocal       byte           // MCSM0.FS_AUTOCAL before CalibrateChannels
+	afc           AFCMode
+	freqEst       int8 // FREQEST of the last valid packet, if not compensated
+	profile       Profile
+	lock
 }
 
-// Open opens the radio device.
+// Open opens the radio device using the default options,
+// as overridden by the environment.
 func Open() *Radio {
-	r := &Radio{hw: radio.Open(hwFlavor{})}
-	v := r.Version()
-	if r.Error() != nil {
+	opts, err := EnvironmentOptions()
+	if err != nil {
+		r := newRadio(spiHardware{Hardware: &radio.Hardware{}, device: opts.SPIDevice, failed: true})
+		r.SetError(err)
+		return r
+	}
+	return OpenWith(opts)
+}
+
+// OpenWith opens the radio device using the given options.
+func OpenWith(opts Options) *Radio {
+	r := OpenHardware(openSPI(opts))
+	if opts.CrystalFrequency != 0 {
+		r.SetCrystalFrequency(uint32(opts.CrystalFrequency))
+	}
+	if opts.Profile != "" && r.Error() == nil {
+		p, ok, err := LoadProfile(opts.Profile, r.Device())
+		if err != nil {
+			r.SetError(err)
+		} else if ok {
+			r.SetProfile(p)
+		}
+	}
+	return r
+}
+
+// OpenHardware opens a radio on top of the given hardware,
+// such as an Emulator.
+func OpenHardware(hw Hardware) *Radio {
+	r := newRadio(hw)
+	r.hold()
+	defer r.release()
+	v := r.version()
+	if r.error() != nil {
 		return r
 	}
 	if v != hwVersion {
 		r.hw.Close()
-		r.SetError(radio.HardwareVersionError{Actual: v, Expected: hwVersion})
+		r.setError(radio.HardwareVersionError{Actual: v, Expected: hwVersion})
 		return r
 	}
-	r.snd = make([]byte, 1)
-	r.rcv = make([]byte, 1)
 	return r
 }
 
 // Close closes the radio device.
 func (r *Radio) Close() {
+	r.hold()
+	defer r.release()
 	r.changeState(SIDLE, STATE_IDLE)
 	r.hw.Close()
 }
 
 // Version returns the radio's hardware version.
 func (r *Radio) Version() uint16 {
+	r.hold()
+	defer r.release()
+	return r.version()
+}
+
+func (r *Radio) version() uint16 {
 	p := r.hw.ReadRegister(PARTNUM)
 	v := r.hw.ReadRegister(VERSION)
 	return uint16(p)<<8 | uint16(v)
@@ -102,33 +322,65 @@ func (*Radio) Name() string {
 }
 
 // Device returns the pathname of the radio's device.
-func (*Radio) Device() string {
-	return spiDevice
+func (r *Radio) Device() string {
+	return r.hw.Device()
 }
 
 // Strobe writes the given command to the radio.
 func (r *Radio) Strobe(cmd byte) byte {
+	r.hold()
+	defer r.release()
+	return r.strobe(cmd)
+}
+
+func (r *Radio) strobe(cmd byte) byte {
 	if verbose && cmd != SNOP {
 		log.Printf("issuing %s command", strobeName(cmd))
 	}
 	r.snd[0] = cmd
-	r.err = r.hw.SPIDevice().Transfer(r.snd, r.rcv)
+	r.err = r.hw.Transfer(r.snd, r.rcv)
 	return r.rcv[0]
 }
 
 // Reset resets the radio device.
 func (r *Radio) Reset() {
-	r.Strobe(SRES)
+	r.hold()
+	defer r.release()
+	r.reset()
+}
+
+func (r *Radio) reset() {
+	r.strobe(SRES)
 }
 
 // Init initializes the radio device.
 func (r *Radio) Init(frequency uint32) {
-	r.Reset()
-	r.InitRF(frequency)
+	r.hold()
+	defer r.release()
+	r.reset()
+	r.initRF(frequency)
 }
 
 // Error returns the error state of the radio device.
+// It does not wait for an operation in progress to complete,
+// but returns the error state as of the end of the previous one.
 func (r *Radio) Error() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.held {
+		return r.published
+	}
+	return r.error()
+}
+
+// SetError sets the error state of the radio device.
+func (r *Radio) SetError(err error) {
+	r.hold()
+	defer r.release()
+	r.setError(err)
+}
+
+func (r *Radio) error() error {
 	err := r.hw.Error()
 	if err != nil {
 		return err
@@ -136,13 +388,23 @@ func (r *Radio) Error() error {
 	return r.err
 }
 
-// SetError sets the error state of the radio device.
-func (r *Radio) SetError(err error) {
+func (r *Radio) setError(err error) {
 	r.hw.SetError(err)
 	r.err = err
 }
 
-// Hardware returns the radio's hardware information.
+// Hardware returns the radio's hardware information,
+// or nil if the radio was opened with OpenHardware
+// on something other than an SPI device.
 func (r *Radio) Hardware() *radio.Hardware {
+	if h, ok := r.hw.(spiHardware); ok {
+		return h.Hardware
+	}
+	return nil
+}
+
+// Backend returns the device underlying the radio:
+// an SPI-attached module or the Hardware passed to OpenHardware.
+func (r *Radio) Backend() Hardware {
 	return r.hw
 }
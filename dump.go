@@ -6,36 +6,42 @@ import (
 
 // DumpRF logs the radio's RF state.
 func (r *Radio) DumpRF() {
-	if r.Error() != nil {
-		log.Fatal(r.Error())
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		log.Fatal(r.error())
 	}
-	log.Printf("State: %s", r.State())
-	log.Printf("Frequency: %d", r.Frequency())
+	log.Printf("State: %s", r.state())
+	log.Printf("Frequency: %d", r.frequency())
 	log.Printf("Channel: %d", r.hw.ReadRegister(CHANNR))
 	r.showFreqSynthControl()
 	r.showModemConfig()
-	pa := r.ReadPATable()
+	pa := r.readPATable()
 	n := r.hw.ReadRegister(FREND0) & FREND0_PA_POWER_MASK
 	log.Printf("PATABLE: % X using 0..%d", pa, n)
 }
 
 func (r *Radio) showFreqSynthControl() {
-	log.Printf("Intermediate frequency: %d Hz", r.ReadIF())
-	log.Printf("Frequency offset: %d Hz", r.hw.ReadRegister(FSCTRL0))
+	log.Printf("Intermediate frequency: %d Hz", r.readIF())
+	log.Printf("Frequency offset: %d Hz", freqEstToHz(r.hw.ReadRegister(FSCTRL0), r.fxosc))
 }
 
 func (r *Radio) showModemConfig() {
-	chanbw, drate := r.ReadChannelParams()
+	chanbw, drate := r.readChannelParams()
 	log.Printf("Channel bandwidth: %d Hz", chanbw)
 	log.Printf("Data rate: %d Baud", drate)
 
 	m2 := r.hw.ReadRegister(MDMCFG2)
 	showBoolCondition("DC blocking filter", m2&MDMCFG2_DEM_DCFILT_OFF == 0)
 	showBoolCondition("Manchester encoding", m2&(1<<3) != 0)
-	log.Printf("Modulation format: %s", modFormat[(m2&MDMCFG2_MOD_FORMAT_MASK)>>4])
+	mod, deviation := r.readModulation()
+	log.Printf("Modulation format: %s", mod)
+	if mod.usesDeviation() {
+		log.Printf("Frequency deviation: %d Hz", deviation)
+	}
 	log.Printf("Sync mode: %s", syncMode[m2&MDMCFG2_SYNC_MODE_MASK])
 
-	fec, minPreamble, chanspc := r.ReadModemConfig()
+	fec, minPreamble, chanspc := r.readModemConfig()
 	showBoolCondition("Forward Error Correction", fec)
 	log.Printf("Min preamble bytes: %d", minPreamble)
 	log.Printf("Channel spacing: %d Hz", chanspc)
@@ -59,7 +65,7 @@ var (
 		"GFSK",
 		"-",
 		"OOK",
-		"-",
+		"4-FSK",
 		"-",
 		"-",
 		"MSK",
@@ -0,0 +1,851 @@
+package cc1101
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrEmulatorClosed indicates an operation on a closed Emulator.
+	ErrEmulatorClosed = errors.New("emulator is closed")
+
+	// ErrInterruptTimeout indicates that no receive interrupt
+	// occurred on an Emulator within the requested timeout.
+	ErrInterruptTimeout = errors.New("timeout waiting for receive interrupt")
+)
+
+// Number of byte periods that elapse in the Emulator per SPI transfer.
+const emulatorAirBytes = 8
+
+// airPacket represents a packet waiting to be received by an Emulator.
+type airPacket struct {
+	data     []byte
+	crcError bool
+	overflow bool
+}
+
+// Emulator is a register-level software model of a CC1101.
+// It decodes SPI transfers the same way the chip does,
+// and can be used in place of real hardware via OpenHardware.
+//
+// Time in the emulator advances by emulatorAirBytes byte periods
+// before each SPI transfer, and while waiting for an interrupt.
+// Each packet is preceded by the configured preamble and sync word,
+// so a packet is never sent or received within a single transfer.
+type Emulator struct {
+	mu sync.Mutex
+
+	config  RFConfiguration
+	patable [8]byte
+	state   byte
+	rssi    byte
+	lqi     byte
+	freqest byte
+	crcOK   bool
+
+	txFIFO  []byte
+	rxFIFO  []byte
+	sending []byte
+	sent    [][]byte
+
+	air       []airPacket
+	incoming  []byte
+	arriving  bool // preamble of the next air packet is being received
+	delay     int  // remaining preamble and sync bytes
+	packetEnd bool // end of packet processing is pending
+	infinite  bool // incoming packet was started in infinite-length mode
+	received  int  // bytes of the incoming packet put in the RXFIFO
+	sync      bool // sync word received since last AwaitInterrupt
+	wor       bool // sleeping in Wake-on-Radio mode
+	sleeping  bool // in SLEEP state after SPWD
+	notReady  int  // transfers until the crystal oscillator is stable
+	trace     []byte
+
+	calibrating  int // time steps until manual calibration is complete
+	calibrations int // frequency synthesizer calibrations performed
+
+	notify chan struct{}
+	closed bool
+	err    error
+}
+
+// NewEmulator returns an Emulator in its power-on reset state.
+func NewEmulator() *Emulator {
+	e := &Emulator{notify: make(chan struct{}, 1)}
+	e.reset()
+	return e
+}
+
+func (e *Emulator) reset() {
+	e.config = ResetRFConfiguration
+	e.patable = [8]byte{0xC6}
+	e.state = STATE_IDLE
+	e.txFIFO = nil
+	e.rxFIFO = nil
+	e.sending = nil
+	e.incoming = nil
+	e.arriving = false
+	e.packetEnd = false
+	e.wor = false
+	e.sleeping = false
+	e.notReady = 0
+	e.calibrating = 0
+}
+
+// Inject queues a packet to be received over the air.
+// The data consists of the bytes following the sync word
+// (including the length byte in variable-length mode),
+// excluding any CRC. It is delivered to the RXFIFO according to
+// the packet handling configuration when the emulated radio is in RX state.
+func (e *Emulator) Inject(data []byte) {
+	p := make([]byte, len(data))
+	copy(p, data)
+	e.queue(airPacket{data: p})
+}
+
+// InjectCorrupted queues a packet that will fail the CRC check
+// when received with CRC enabled.
+func (e *Emulator) InjectCorrupted(data []byte) {
+	p := make([]byte, len(data))
+	copy(p, data)
+	e.queue(airPacket{data: p, crcError: true})
+}
+
+// InjectOverflow queues a burst of data large enough
+// to cause an RXFIFO overflow when the emulated radio is in RX state.
+func (e *Emulator) InjectOverflow() {
+	e.queue(airPacket{overflow: true})
+}
+
+func (e *Emulator) queue(p airPacket) {
+	e.mu.Lock()
+	e.air = append(e.air, p)
+	e.update()
+	e.mu.Unlock()
+	select {
+	case e.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Transmitted returns the packets transmitted since the last call.
+// Each packet consists of the bytes following the sync word
+// (including the length byte in variable-length mode),
+// excluding any CRC.
+func (e *Emulator) Transmitted() [][]byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.update()
+	sent := e.sent
+	e.sent = nil
+	return sent
+}
+
+// SetRSSI sets the value, in dBm, reported by the RSSI status register.
+func (e *Emulator) SetRSSI(dBm int) {
+	const rssiOffset = 74 // see data sheet section 17.3
+	e.mu.Lock()
+	e.rssi = byte(2 * (dBm + rssiOffset))
+	e.mu.Unlock()
+}
+
+// SetLQI sets the link quality indicator reported for received packets.
+func (e *Emulator) SetLQI(lqi byte) {
+	e.mu.Lock()
+	e.lqi = lqi & LQI_LQI_EST_MASK
+	e.mu.Unlock()
+}
+
+// SetFREQEST sets the frequency offset of received packets,
+// in units of FXOSC/2^14 Hz. The FREQEST status register reports
+// this offset less the compensation in FSCTRL0.
+func (e *Emulator) SetFREQEST(v int8) {
+	e.mu.Lock()
+	e.freqest = byte(v)
+	e.mu.Unlock()
+}
+
+// Configuration returns the current contents of the configuration registers.
+func (e *Emulator) Configuration() RFConfiguration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.config
+}
+
+// State returns the current state of the emulated radio.
+func (e *Emulator) State() byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.update()
+	return e.state
+}
+
+// StateTrace returns the sequence of states entered by the emulated radio
+// since the previous call.
+func (e *Emulator) StateTrace() []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	trace := e.trace
+	e.trace = nil
+	return trace
+}
+
+// Calibrations returns the number of frequency synthesizer calibrations,
+// either strobed with SCAL or performed automatically according to
+// MCSM0.FS_AUTOCAL, since the previous call.
+func (e *Emulator) Calibrations() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.update()
+	n := e.calibrations
+	e.calibrations = 0
+	return n
+}
+
+// Device returns a name for the emulated device.
+func (*Emulator) Device() string {
+	return "emulator"
+}
+
+// Close closes the emulated device.
+func (e *Emulator) Close() {
+	e.mu.Lock()
+	e.closed = true
+	e.mu.Unlock()
+}
+
+// Error returns the error state of the emulated device.
+func (e *Emulator) Error() error {
+	return e.err
+}
+
+// SetError sets the error state of the emulated device.
+func (e *Emulator) SetError(err error) {
+	e.err = err
+}
+
+// ReadRegister reads the given address on the emulated device.
+func (e *Emulator) ReadRegister(addr byte) byte {
+	if e.Error() != nil {
+		return 0
+	}
+	buf := []byte{hwFlavor{}.ReadSingleAddress(addr), 0}
+	e.err = e.Transfer(buf, buf)
+	return buf[1]
+}
+
+// ReadBurst reads a burst of n bytes from given address on the emulated device.
+func (e *Emulator) ReadBurst(addr byte, n int) []byte {
+	if e.Error() != nil {
+		return nil
+	}
+	if err := checkBurstAddress(addr); err != nil {
+		e.err = err
+		return nil
+	}
+	buf := make([]byte, n+1)
+	buf[0] = hwFlavor{}.ReadBurstAddress(addr)
+	e.err = e.Transfer(buf, buf)
+	return buf[1:]
+}
+
+// WriteRegister writes the given value to the given address on the emulated device.
+func (e *Emulator) WriteRegister(addr byte, value byte) {
+	buf := []byte{hwFlavor{}.WriteSingleAddress(addr), value}
+	e.err = e.Transfer(buf, buf)
+}
+
+// WriteBurst writes data in burst mode to the given address on the emulated device.
+func (e *Emulator) WriteBurst(addr byte, data []byte) {
+	buf := make([]byte, len(data)+1)
+	buf[0] = hwFlavor{}.WriteBurstAddress(addr)
+	copy(buf[1:], data)
+	e.err = e.Transfer(buf, buf)
+}
+
+// AwaitInterrupt waits with the given timeout for a receive interrupt,
+// or, if GDO0 is configured for the inverted TX FIFO threshold signal,
+// for the TXFIFO to drain below the threshold.
+func (e *Emulator) AwaitInterrupt(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		if e.interrupt() {
+			e.err = nil
+			return
+		}
+		select {
+		case <-e.notify:
+		case <-timer.C:
+			e.err = ErrInterruptTimeout
+			return
+		}
+	}
+}
+
+// interrupt reports whether an interrupt has occurred,
+// clearing the latched receive interrupt.
+func (e *Emulator) interrupt() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.update()
+	if e.config.IOCFG0&(GDO0_INV|GDO0_CFG_MASK) == GDO0_INV|gdoTXFIFOThreshold {
+		// Let time pass while the TXFIFO drains.
+		threshold := txThresholdBytes(e.config.FIFOTHR)
+		for e.state == STATE_TX && len(e.txFIFO) >= threshold {
+			e.update()
+		}
+		return len(e.txFIFO) < threshold
+	}
+	// Let time pass while a packet is arriving.
+	for e.state == STATE_RX && e.arriving {
+		e.update()
+	}
+	sync := e.sync
+	e.sync = false
+	return sync
+}
+
+// ReadInterrupt returns the state of the receive interrupt.
+// It is active while a packet is being received.
+func (e *Emulator) ReadInterrupt() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.update()
+	switch e.state {
+	case STATE_RX:
+		return len(e.rxFIFO) != 0 || len(e.incoming) != 0
+	case STATE_RXFIFO_OVERFLOW:
+		return true
+	default:
+		return false
+	}
+}
+
+// Transfer performs an SPI transfer with the emulated device.
+// The first byte sent is the header, which is decoded
+// according to section 10 of the data sheet.
+// The first byte received is the chip status byte.
+func (e *Emulator) Transfer(snd, rcv []byte) error {
+	if len(snd) != len(rcv) {
+		return fmt.Errorf("transfer buffers must be the same length (snd = %d, rcv = %d)", len(snd), len(rcv))
+	}
+	if len(snd) == 0 {
+		return fmt.Errorf("empty transfer")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrEmulatorClosed
+	}
+	e.update()
+	// Pulling CSn low brings the radio out of SLEEP state.
+	e.wor = false
+	if e.sleeping {
+		e.wake()
+	}
+	if e.notReady > 0 {
+		// The chip ignores SPI data until the crystal oscillator is stable.
+		e.notReady--
+		rcv[0] = e.statusByte(false) | CHIP_RDY
+		return nil
+	}
+	header := snd[0]
+	read := header&READ_MODE != 0
+	burst := header&BURST_MODE != 0
+	addr := header &^ (READ_MODE | BURST_MODE)
+	rcv[0] = e.statusByte(read)
+	switch {
+	case addr == TXFIFO:
+		e.transferFIFO(read, snd[1:], rcv[1:])
+	case addr == PATABLE:
+		// The PATABLE index counter is reset at the start of each transfer.
+		for i := 1; i < len(snd); i++ {
+			e.transferByte(read, &e.patable[(i-1)%len(e.patable)], snd[i], &rcv[i])
+		}
+	case addr >= SRES:
+		if read && burst {
+			for i := 1; i < len(snd); i++ {
+				rcv[i] = e.statusRegister(addr | BURST_MODE)
+			}
+		} else {
+			e.strobe(addr)
+		}
+	default:
+		regs := e.config.Bytes()
+		for i := 1; i < len(snd); i++ {
+			if i > 1 && !burst {
+				break
+			}
+			a := int(addr) + i - 1
+			if a >= len(regs) {
+				break
+			}
+			e.transferByte(read, &regs[a], snd[i], &rcv[i])
+		}
+	}
+	return nil
+}
+
+// channelClear performs clear channel assessment
+// according to MCSM1.CCA_MODE.
+// Only the absolute carrier sense threshold is emulated.
+func (e *Emulator) channelClear() bool {
+	threshold, ok := carrierSenseThreshold(e.config.AGCCTRL2, e.config.AGCCTRL1)
+	carrier := ok && rssiToDBm(e.rssi) >= threshold
+	receiving := e.arriving || len(e.incoming) != 0
+	switch e.config.MCSM1 & (3 << 4) {
+	case MCSM1_CCA_MODE_RSSI_BELOW:
+		return !carrier
+	case MCSM1_CCA_MODE_UNLESS_RECEIVING:
+		return !receiving
+	case MCSM1_CCA_MODE_RSSI_BELOW_UNLESS_RECEIVING:
+		return !carrier && !receiving
+	default:
+		return true
+	}
+}
+
+// wake brings the emulated radio out of SLEEP state.
+// The TEST registers and PATABLE are not retained in SLEEP,
+// so they are reset to their default values.
+func (e *Emulator) wake() {
+	e.sleeping = false
+	e.notReady = 2
+	regs := e.config.Bytes()
+	reset := ResetRFConfiguration.Bytes()
+	copy(regs[FSTEST:TEST0+1], reset[FSTEST:TEST0+1])
+	e.patable = [8]byte{0xC6}
+}
+
+func (e *Emulator) transferByte(read bool, reg *byte, snd byte, rcv *byte) {
+	if read {
+		*rcv = *reg
+	} else {
+		*reg = snd
+		*rcv = e.statusByte(false)
+	}
+}
+
+func (e *Emulator) transferFIFO(read bool, snd, rcv []byte) {
+	for i := range snd {
+		if read {
+			if len(e.rxFIFO) == 0 {
+				rcv[i] = 0
+				continue
+			}
+			rcv[i] = e.rxFIFO[0]
+			e.rxFIFO = e.rxFIFO[1:]
+			continue
+		}
+		if len(e.txFIFO) < fifoSize {
+			e.txFIFO = append(e.txFIFO, snd[i])
+		}
+		rcv[i] = e.statusByte(false)
+	}
+}
+
+// statusByte returns the chip status byte (see section 10.1 of the data sheet).
+// CHIP_RDY is active low, so it is always clear.
+func (e *Emulator) statusByte(read bool) byte {
+	n := fifoSize - len(e.txFIFO)
+	if read {
+		n = len(e.rxFIFO)
+	}
+	if n > 15 {
+		n = 15
+	}
+	return e.state<<STATE_SHIFT | byte(n)
+}
+
+func (e *Emulator) statusRegister(addr byte) byte {
+	switch addr {
+	case PARTNUM:
+		return byte(hwVersion >> 8)
+	case VERSION:
+		return byte(hwVersion & 0xFF)
+	case FREQEST:
+		return e.freqEstimate()
+	case LQI:
+		if e.crcOK {
+			return e.lqi | LQI_CRC_OK
+		}
+		return e.lqi
+	case RSSI:
+		return e.rssi
+	case MARCSTATE:
+		return marcStateOf[e.state]
+	case TXBYTES:
+		n := byte(len(e.txFIFO))
+		if e.state == STATE_TXFIFO_UNDERFLOW {
+			n |= TXFIFO_UNDERFLOW
+		}
+		return n
+	case RXBYTES:
+		n := byte(len(e.rxFIFO))
+		if e.state == STATE_RXFIFO_OVERFLOW {
+			n |= RXFIFO_OVERFLOW
+		}
+		return n
+	default:
+		return 0
+	}
+}
+
+var marcStateOf = []byte{
+	STATE_IDLE:             MARCSTATE_IDLE,
+	STATE_RX:               MARCSTATE_RX,
+	STATE_TX:               MARCSTATE_TX,
+	STATE_FSTXON:           MARCSTATE_FSTXON,
+	STATE_CALIBRATE:        MARCSTATE_MANCAL,
+	STATE_SETTLING:         MARCSTATE_FS_LOCK,
+	STATE_RXFIFO_OVERFLOW:  MARCSTATE_RX_OVERFLOW,
+	STATE_TXFIFO_UNDERFLOW: MARCSTATE_TX_UNDERFLOW,
+}
+
+func (e *Emulator) strobe(cmd byte) {
+	switch cmd {
+	case SRES:
+		e.reset()
+	case SFSTXON:
+		if e.state == STATE_IDLE || e.state == STATE_RX {
+			e.autocal()
+			e.setState(STATE_FSTXON)
+		}
+	case SRX:
+		if e.state == STATE_IDLE || e.state == STATE_FSTXON || e.state == STATE_TX {
+			e.autocal()
+			e.setState(STATE_RX)
+		}
+	case STX:
+		if e.state == STATE_IDLE || e.state == STATE_FSTXON || (e.state == STATE_RX && e.channelClear()) {
+			e.autocal()
+			e.setState(STATE_TX)
+		}
+	case SAFC:
+		e.config.FSCTRL0 += e.freqEstimate()
+	case SCAL:
+		if e.state == STATE_IDLE {
+			e.calibrating = emulatorCalibrationSteps
+			e.setState(STATE_CALIBRATE)
+		}
+	case SIDLE:
+		e.setState(STATE_IDLE)
+	case SPWD:
+		if e.state == STATE_IDLE {
+			e.sleeping = true
+		}
+	case SWOR:
+		if e.state == STATE_IDLE && e.config.WORCTRL&WORCTRL_RC_PD == 0 {
+			e.wor = true
+		}
+	case SFRX:
+		if e.state == STATE_IDLE || e.state == STATE_RXFIFO_OVERFLOW {
+			e.rxFIFO = nil
+			e.incoming = nil
+			e.setState(STATE_IDLE)
+		}
+	case SFTX:
+		if e.state == STATE_IDLE || e.state == STATE_TXFIFO_UNDERFLOW {
+			e.txFIFO = nil
+			e.setState(STATE_IDLE)
+		}
+	}
+}
+
+func (e *Emulator) setState(s byte) {
+	if e.state == STATE_TX && s != STATE_TX {
+		e.finishTX()
+	}
+	if e.state != STATE_RX && s == STATE_RX {
+		e.sync = false
+	}
+	if e.state == STATE_RX && s != STATE_RX {
+		// Anything not yet received is lost.
+		e.incoming = nil
+		e.arriving = false
+		e.packetEnd = false
+	}
+	if e.state != STATE_TX && s == STATE_TX {
+		e.delay = e.preambleBytes()
+	}
+	if s != e.state {
+		e.trace = append(e.trace, s)
+	}
+	e.state = s
+}
+
+// offModeState maps the RXOFF_MODE and TXOFF_MODE fields of MCSM1
+// to the state entered when a packet has been received or sent.
+var offModeState = []byte{STATE_IDLE, STATE_FSTXON, STATE_TX, STATE_RX}
+
+// preambleBytes returns the number of preamble and sync word bytes
+// sent before each packet.
+func (e *Emulator) preambleBytes() int {
+	n := int(numPreamble[(e.config.MDMCFG1&MDMCFG1_NUM_PREAMBLE_MASK)>>4])
+	switch e.config.MDMCFG2 & 0x3 {
+	case MDMCFG2_SYNC_MODE_15_16, MDMCFG2_SYNC_MODE_16_16:
+		n += 2
+	case MDMCFG2_SYNC_MODE_30_32:
+		n += 4
+	}
+	return n
+}
+
+// elapse lets the given number of byte periods elapse
+// while sending or receiving the preamble and sync word.
+// It returns the number of periods remaining.
+func (e *Emulator) elapse(n int) int {
+	d := e.delay
+	if d > n {
+		d = n
+	}
+	e.delay -= d
+	return n - d
+}
+
+func (e *Emulator) lengthConfig() byte {
+	return e.config.PKTCTRL0 & 0x3
+}
+
+func (e *Emulator) finishTX() {
+	if len(e.sending) == 0 {
+		return
+	}
+	e.sent = append(e.sent, e.sending)
+	e.sending = nil
+}
+
+// freqEstimate returns the value of the FREQEST status register.
+func (e *Emulator) freqEstimate() byte {
+	return e.freqest - e.config.FSCTRL0
+}
+
+// Number of time steps taken by a calibration strobed with SCAL.
+const emulatorCalibrationSteps = 2
+
+// autocal counts a calibration when leaving IDLE state,
+// if MCSM0.FS_AUTOCAL requires it. Automatic calibrations
+// take no time and do not change the FSCAL registers.
+func (e *Emulator) autocal() {
+	if e.state == STATE_IDLE && e.config.MCSM0&MCSM0_FS_AUTOCAL_TO_IDLE_EVERY_4 == MCSM0_FS_AUTOCAL_FROM_IDLE {
+		e.calibrations++
+	}
+}
+
+// calibrate stores calibration results in FSCAL3, FSCAL2, and FSCAL1
+// that depend on the frequency of the current channel.
+func (e *Emulator) calibrate() {
+	c := &e.config
+	f := uint32(c.FREQ2)<<16 | uint32(c.FREQ1)<<8 | uint32(c.FREQ0)
+	chanspcE := c.MDMCFG1 & MDMCFG1_CHANSPC_E_MASK
+	f += uint32(c.CHANNR) * (256 + uint32(c.MDMCFG0)) << chanspcE >> 2
+	c.FSCAL3 = c.FSCAL3&0xF0 | byte(f>>4)&0x0F
+	c.FSCAL2 = c.FSCAL2&0x20 | byte(f>>8)&0x1F
+	c.FSCAL1 = byte(f) & 0x3F
+	e.calibrations++
+}
+
+// update advances the emulated radio by one time step.
+func (e *Emulator) update() {
+	switch e.state {
+	case STATE_CALIBRATE:
+		e.calibrating--
+		if e.calibrating == 0 {
+			e.calibrate()
+			e.setState(STATE_IDLE)
+		}
+	case STATE_IDLE:
+		// In Wake-on-Radio mode, every packet is assumed
+		// to arrive while the radio is awake.
+		if e.wor && len(e.air) != 0 {
+			e.wor = false
+			e.setState(STATE_RX)
+			e.receive()
+		}
+	case STATE_TX:
+		e.transmit()
+	case STATE_RX:
+		e.receive()
+	}
+}
+
+func (e *Emulator) transmit() {
+	n := e.elapse(emulatorAirBytes)
+	i := 0
+	for ; i < n && len(e.txFIFO) != 0 && !e.txComplete(); i++ {
+		e.sending = append(e.sending, e.txFIFO[0])
+		e.txFIFO = e.txFIFO[1:]
+	}
+	if e.txComplete() {
+		e.finishTX()
+		e.setState(offModeState[e.config.MCSM1&0x3])
+		return
+	}
+	if i < n && len(e.sending) != 0 {
+		// The TXFIFO ran out of data before the end of the packet.
+		// (Underflow of an empty TXFIFO before the packet starts
+		// is not emulated.)
+		e.setState(STATE_TXFIFO_UNDERFLOW)
+	}
+}
+
+// txComplete reports whether the packet being transmitted is complete.
+// In infinite-length mode, this is never the case.
+func (e *Emulator) txComplete() bool {
+	n := len(e.sending)
+	switch e.lengthConfig() {
+	case PKTCTRL0_LENGTH_CONFIG_FIXED:
+		// The packet handler's byte counter wraps around,
+		// so a packet started in infinite-length mode
+		// can be longer than 255 bytes.
+		return n != 0 && n%256 == int(e.config.PKTLEN)
+	case PKTCTRL0_LENGTH_CONFIG_VARIABLE:
+		return n != 0 && n >= 1+int(e.sending[0])
+	default:
+		return false
+	}
+}
+
+func (e *Emulator) receive() {
+	if len(e.incoming) == 0 {
+		// Start a new packet only after the previous one has been read,
+		// unless the radio stays in RX state after receiving a packet.
+		stayRX := e.config.MCSM1&(3<<2) == MCSM1_RXOFF_MODE_RX
+		if e.packetEnd || len(e.air) == 0 || (len(e.rxFIFO) != 0 && !stayRX) {
+			e.endPacket()
+			return
+		}
+		if !e.arriving {
+			e.arriving = true
+			e.delay = e.preambleBytes()
+		}
+		if e.elapse(emulatorAirBytes) == 0 {
+			return
+		}
+		e.arriving = false
+		p := e.air[0]
+		e.air = e.air[1:]
+		if p.overflow {
+			for len(e.rxFIFO) < fifoSize {
+				e.rxFIFO = append(e.rxFIFO, 0xFF)
+			}
+			e.sync = true
+			e.setState(STATE_RXFIFO_OVERFLOW)
+			return
+		}
+		data, ok := e.frame(p)
+		if !ok {
+			return
+		}
+		e.incoming = data
+		e.infinite = e.lengthConfig() == PKTCTRL0_LENGTH_CONFIG_INFINITE
+		e.packetEnd = !e.infinite
+		e.received = 0
+		e.sync = true
+	}
+	if e.infinite && e.lengthConfig() == PKTCTRL0_LENGTH_CONFIG_FIXED {
+		// Switched to fixed-length mode during the packet:
+		// it ends when the byte counter reaches PKTLEN (modulo 256).
+		e.infinite = false
+		end := (int(e.config.PKTLEN) - e.received) & 0xFF
+		if end == 0 {
+			end = 256
+		}
+		e.incoming = e.appendStatus(resize(e.incoming, end))
+		e.packetEnd = true
+	}
+	n := fifoSize - len(e.rxFIFO)
+	if n > len(e.incoming) {
+		n = len(e.incoming)
+	}
+	e.rxFIFO = append(e.rxFIFO, e.incoming[:n]...)
+	e.incoming = e.incoming[n:]
+	e.received += n
+	e.endPacket()
+}
+
+// endPacket performs end of packet processing
+// once all of an incoming packet has been put in the RXFIFO.
+func (e *Emulator) endPacket() {
+	if !e.packetEnd || len(e.incoming) != 0 {
+		return
+	}
+	e.packetEnd = false
+	e.setState(offModeState[(e.config.MCSM1>>2)&0x3])
+}
+
+// frame returns the RXFIFO contents for a packet received over the air,
+// according to the packet handling configuration,
+// or false if the packet is discarded by the packet handler.
+func (e *Emulator) frame(p airPacket) ([]byte, bool) {
+	data := p.data
+	addr := 0
+	switch e.lengthConfig() {
+	case PKTCTRL0_LENGTH_CONFIG_FIXED:
+		data = resize(data, int(e.config.PKTLEN))
+	case PKTCTRL0_LENGTH_CONFIG_VARIABLE:
+		if len(data) == 0 || data[0] > e.config.PKTLEN {
+			return nil, false
+		}
+		data = resize(data, 1+int(data[0]))
+		addr = 1
+	}
+	crcEnabled := e.config.PKTCTRL0&PKTCTRL0_CRC_EN != 0
+	e.crcOK = crcEnabled && !p.crcError
+	if e.lengthConfig() == PKTCTRL0_LENGTH_CONFIG_INFINITE {
+		// The end of the packet, if any, is not known yet.
+		return data, true
+	}
+	if !e.addressMatches(data, addr) {
+		return nil, false
+	}
+	if crcEnabled && p.crcError && e.config.PKTCTRL1&PKTCTRL1_CRC_AUTOFLUSH != 0 {
+		return nil, false
+	}
+	return e.appendStatus(data), true
+}
+
+// appendStatus appends the status bytes to the end of a received packet,
+// if PKTCTRL1.APPEND_STATUS is set.
+func (e *Emulator) appendStatus(data []byte) []byte {
+	if e.config.PKTCTRL1&PKTCTRL1_APPEND_STATUS == 0 {
+		return data
+	}
+	status := e.lqi & PKT_APPEND_STATUS_1_LQI_MASK
+	if e.crcOK {
+		status |= PKT_APPEND_STATUS_1_CRC_OK
+	}
+	return append(data, e.rssi, status)
+}
+
+// addressMatches reports whether the address byte at data[i]
+// passes the packet handler's address filter.
+func (e *Emulator) addressMatches(data []byte, i int) bool {
+	filter := e.config.PKTCTRL1 & 0x3
+	if filter == PKTCTRL1_ADR_CHK_NONE {
+		return true
+	}
+	if i >= len(data) {
+		return false
+	}
+	switch a := data[i]; {
+	case a == e.config.ADDR:
+		return true
+	case a == 0x00:
+		return filter != PKTCTRL1_ADR_CHK_NO_BROADCAST
+	case a == 0xFF:
+		return filter == PKTCTRL1_ADR_CHK_00_FF_BROADCAST
+	default:
+		return false
+	}
+}
+
+// resize returns a copy of data truncated or zero-padded to n bytes.
+func resize(data []byte, n int) []byte {
+	p := make([]byte, n, n+2)
+	copy(p, data)
+	return p
+}
@@ -0,0 +1,261 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func openEmulator(t *testing.T) (*Radio, *Emulator) {
+	e := NewEmulator()
+	r := OpenHardware(e)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	return r, e
+}
+
+func TestEmulatorRegisters(t *testing.T) {
+	r, e := openEmulator(t)
+	if r.Hardware() != nil {
+		t.Errorf("Hardware() of emulated radio is not nil")
+	}
+	hw := r.Backend()
+	hw.WriteRegister(SYNC1, 0x44)
+	hw.WriteRegister(SYNC0, 0x55)
+	if x, y := hw.ReadRegister(SYNC1), hw.ReadRegister(SYNC0); x != 0x44 || y != 0x55 {
+		t.Errorf("single read == %X %X, want 44 55", x, y)
+	}
+	hw.WriteBurst(SYNC1, []byte{0x66, 0x77})
+	if v := hw.ReadBurst(SYNC1, 2); !bytes.Equal(v, []byte{0x66, 0x77}) {
+		t.Errorf("burst read == % X, want 66 77", v)
+	}
+	r.Reset()
+	config := r.ReadConfiguration()
+	if *config != ResetRFConfiguration {
+		t.Errorf("configuration after reset == % X, want % X", config.Bytes(), ResetRFConfiguration.Bytes())
+	}
+	r.InitRF(916600000)
+	if e.Configuration() != *r.ReadConfiguration() {
+		t.Errorf("emulator configuration does not match configuration read by radio")
+	}
+	pa := r.ReadPATable()
+	if !bytes.Equal(pa[:2], []byte{0x00, 0xC0}) {
+		t.Errorf("PATABLE == % X, want 00 C0", pa)
+	}
+	if f := r.Frequency(); f != 916599975 {
+		t.Errorf("Frequency() == %d, want 916599975", f)
+	}
+	if r.Error() != nil {
+		t.Error(r.Error())
+	}
+}
+
+func TestEmulatorStrobes(t *testing.T) {
+	r, e := openEmulator(t)
+	cases := []struct {
+		strobe byte
+		state  byte
+	}{
+		{SRX, STATE_RX},
+		{SIDLE, STATE_IDLE},
+		{STX, STATE_TX},
+		{SRX, STATE_RX},
+		{SFSTXON, STATE_FSTXON},
+		{SIDLE, STATE_IDLE},
+	}
+	for _, c := range cases {
+		prev := e.State()
+		status := r.Strobe(c.strobe)
+		if status&CHIP_RDY != 0 {
+			t.Errorf("%s: CHIP_RDY not asserted in status %02X", strobeName(c.strobe), status)
+		}
+		if s := (status >> STATE_SHIFT) & STATE_MASK; s != prev {
+			t.Errorf("%s: status byte reports %s, want %s", strobeName(c.strobe), StateName(s), StateName(prev))
+		}
+		if r.ReadState() != c.state {
+			t.Errorf("%s: state == %s, want %s", strobeName(c.strobe), r.State(), StateName(c.state))
+		}
+	}
+}
+
+func TestEmulatorSend(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	for _, n := range []int{1, 10, 100} {
+		data := testPacket(n)
+		r.Send(data)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		sent := e.Transmitted()
+		if len(sent) != 1 {
+			t.Fatalf("%d-byte packet transmitted as %d packets", n, len(sent))
+		}
+		want := append(data, 0, 0)
+		if !bytes.Equal(sent[0], want) {
+			t.Errorf("transmitted % X, want % X", sent[0], want)
+		}
+		if r.ReadState() != STATE_IDLE {
+			t.Errorf("state after Send == %s, want IDLE", r.State())
+		}
+	}
+}
+
+func TestSendLargePacket(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	r.SetPacketFormat(VariableLength, 255, true)
+	data := binaryPacket(255)
+	want := append([]byte{byte(len(data))}, data...)
+	for _, baud := range []uint32{4800, 38400, 250000} {
+		r.SetDataRate(baud)
+		before := e.Configuration()
+		bt := r.byteTime()
+		if want := time.Duration(8 * uint64(time.Second) / uint64(baud)); absDuration(bt-want) > want/100 {
+			t.Errorf("%d baud: byte time == %v, want %v", baud, bt, want)
+		}
+		r.Send(data)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		sent := e.Transmitted()
+		if len(sent) != 1 || !bytes.Equal(sent[0], want) {
+			t.Errorf("%d baud: transmitted %d packets, want 1 of %d bytes", baud, len(sent), len(want))
+		}
+		if e.Configuration() != before {
+			t.Errorf("%d baud: configuration was not restored", baud)
+		}
+	}
+}
+
+func TestTXThresholdBytes(t *testing.T) {
+	cases := []struct {
+		fifothr   byte
+		threshold int
+	}{
+		{0, 61},
+		{7, 33},
+		{15, 1},
+		{0x40 | 7, 33},
+	}
+	for _, c := range cases {
+		if n := txThresholdBytes(c.fifothr); n != c.threshold {
+			t.Errorf("txThresholdBytes(%02X) == %d, want %d", c.fifothr, n, c.threshold)
+		}
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func TestEmulatorReceive(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	e.SetRSSI(-60)
+	for _, n := range []int{1, 10, 100} {
+		data := testPacket(n)
+		e.Inject(append(data, 0))
+		p, rssi := r.Receive(time.Second)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if !bytes.Equal(p, data) {
+			t.Errorf("received % X, want % X", p, data)
+		}
+		if rssi != -60 {
+			t.Errorf("RSSI == %d, want -60", rssi)
+		}
+	}
+}
+
+func TestEmulatorReceiveOverflow(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	data := testPacket(20)
+	e.InjectOverflow()
+	e.Inject(append(data, 0))
+	p, _ := r.Receive(time.Second)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if !bytes.Equal(p, data) {
+		t.Errorf("received % X, want % X", p, data)
+	}
+}
+
+func TestEmulatorReceiveTimeout(t *testing.T) {
+	r, _ := openEmulator(t)
+	r.InitRF(916600000)
+	p, _ := r.Receive(10 * time.Millisecond)
+	if p != nil {
+		t.Errorf("received % X, want nothing", p)
+	}
+	if r.ReadState() != STATE_IDLE {
+		t.Errorf("state after timeout == %s, want IDLE", r.State())
+	}
+}
+
+func TestSendAndReceive(t *testing.T) {
+	cases := []struct {
+		format PacketFormat
+		frame  func([]byte) []byte
+	}{
+		{ZeroTerminated, func(data []byte) []byte { return append(data, 0, 0) }},
+		{VariableLength, func(data []byte) []byte { return append([]byte{byte(len(data))}, data...) }},
+	}
+	for _, c := range cases {
+		r, e := openEmulator(t)
+		r.InitRF(916600000)
+		if c.format != ZeroTerminated {
+			r.SetPacketFormat(c.format, 61, true)
+		}
+		before := e.Configuration()
+		request := testPacket(20)
+		response := testPacket(40)
+		e.Inject(c.frame(response))
+		e.StateTrace()
+		p, _ := r.SendAndReceive(request, time.Second)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if !bytes.Equal(p, response) {
+			t.Errorf("%v: received % X, want % X", c.format, p, response)
+		}
+		sent := e.Transmitted()
+		if len(sent) != 1 || !bytes.Equal(sent[0], c.frame(request)) {
+			t.Errorf("%v: transmitted % X, want % X", c.format, sent, c.frame(request))
+		}
+		// The radio must go directly from TX to RX,
+		// and stay there until the response is received.
+		trace := e.StateTrace()
+		want := []byte{STATE_TX, STATE_RX, STATE_IDLE}
+		if !bytes.Equal(trace, want) {
+			t.Errorf("%v: state trace == %v, want %v", c.format, stateNames(trace), stateNames(want))
+		}
+		if e.Configuration() != before {
+			t.Errorf("%v: configuration was not restored", c.format)
+		}
+	}
+}
+
+func stateNames(states []byte) []string {
+	names := make([]string, len(states))
+	for i, s := range states {
+		names[i] = StateName(s)
+	}
+	return names
+}
+
+// testPacket returns a packet of the given size with no zero bytes.
+func testPacket(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i%255 + 1)
+	}
+	return p
+}
@@ -0,0 +1,93 @@
+package cc1101
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPacketTooLarge(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 20, true)
+	data := binaryPacket(21)
+	sends := []struct {
+		name string
+		send func()
+	}{
+		{"Send", func() { r.Send(data) }},
+		{"SendTo", func() { r.SendTo(0x10, data) }},
+		{"SendWhenClear", func() { r.SendWhenClear(data, 0, 10*time.Millisecond) }},
+		{"SendAndReceive", func() { r.SendAndReceive(data, 10*time.Millisecond) }},
+	}
+	for _, s := range sends {
+		r.SetError(nil)
+		s.send()
+		if !errors.Is(r.Error(), ErrPacketTooLarge) {
+			t.Errorf("%s: error == %v, want ErrPacketTooLarge", s.name, r.Error())
+		}
+		if sent := e.Transmitted(); len(sent) != 0 {
+			t.Errorf("%s: transmitted %d packets, want none", s.name, len(sent))
+		}
+	}
+	// The error state is not overwritten.
+	r.SetError(ErrChannelBusy)
+	r.Send(data)
+	if r.Error() != ErrChannelBusy {
+		t.Errorf("error == %v, want ErrChannelBusy", r.Error())
+	}
+}
+
+func TestNoBurstAccess(t *testing.T) {
+	r, _ := openEmulator(t)
+	hw := r.Backend()
+	for _, addr := range []byte{MARCSTATE, TXBYTES, RXBYTES} {
+		r.SetError(nil)
+		if v := hw.ReadBurst(addr, 2); v != nil {
+			t.Errorf("burst read of %02X returned % X", addr, v)
+		}
+		if !errors.Is(r.Error(), ErrNoBurstAccess) {
+			t.Errorf("burst read of %02X: error == %v, want ErrNoBurstAccess", addr, r.Error())
+		}
+	}
+	r.SetError(nil)
+	hw.ReadBurst(SYNC1, 2)
+	if r.Error() != nil {
+		t.Errorf("burst read of SYNC1: %v", r.Error())
+	}
+}
+
+// idleDuringTX is Hardware that returns the radio to IDLE state
+// behind the driver's back while a packet is being sent.
+type idleDuringTX struct {
+	*Emulator
+}
+
+func (h idleDuringTX) ReadRegister(addr byte) byte {
+	if addr == TXBYTES && h.State() == STATE_TX {
+		h.Transfer([]byte{SIDLE}, make([]byte, 1))
+	}
+	return h.Emulator.ReadRegister(addr)
+}
+
+func TestUnexpectedState(t *testing.T) {
+	e := NewEmulator()
+	r := OpenHardware(idleDuringTX{e})
+	r.InitRF(916600000)
+	r.Send(testPacket(50))
+	err := r.Error()
+	if !errors.Is(err, ErrUnexpectedState) {
+		t.Fatalf("error == %v, want ErrUnexpectedState", err)
+	}
+	var se StateError
+	if !errors.As(err, &se) || se.State != STATE_IDLE {
+		t.Errorf("error == %#v, want StateError for IDLE state", err)
+	}
+	if !strings.Contains(err.Error(), StateName(STATE_IDLE)) {
+		t.Errorf("error %q does not contain state name", err)
+	}
+	if r.ReadState() != STATE_IDLE {
+		t.Errorf("state == %s, want IDLE", r.State())
+	}
+}
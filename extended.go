@@ -0,0 +1,74 @@
+package cc1101
+
+// Maximum payload length of ExtendedLength and ZeroTerminated packets.
+const maxExtendedLength = 0xFFFF
+
+// Minimum number of bytes sent for an ExtendedLength packet.
+// Shorter packets are padded, so that the receiver has time
+// to read the length field and switch to fixed-length mode
+// before the end of the packet.
+const minExtendedFrame = 2 * fifoSize
+
+// extendedFrameSize returns the number of bytes sent
+// for an ExtendedLength packet with an n-byte payload.
+func extendedFrameSize(n int) int {
+	n += 2
+	if n < minExtendedFrame {
+		n = minExtendedFrame
+	}
+	return n
+}
+
+// extendedFrame returns the bytes to be written to the TXFIFO
+// to send the given payload as an ExtendedLength packet.
+func extendedFrame(data []byte) []byte {
+	packet := make([]byte, extendedFrameSize(len(data)))
+	packet[0] = byte(len(data) >> 8)
+	packet[1] = byte(len(data))
+	copy(packet[2:], data)
+	return packet
+}
+
+// setLength configures the packet handler to end an n-byte packet by itself.
+// Packets of up to 255 bytes use fixed-length mode. Longer packets
+// start in infinite-length mode with PKTLEN = n mod 256, and switchLength
+// must be called as the packet progresses to switch to fixed-length mode.
+// See TI Design Note DN500 (swra109c).
+func (r *Radio) setLength(n int) {
+	r.hw.WriteRegister(PKTLEN, byte(n))
+	r.lengthSwitch = n > 0xFF
+	if r.lengthSwitch {
+		r.setLengthConfig(PKTCTRL0_LENGTH_CONFIG_INFINITE)
+	} else {
+		r.setLengthConfig(PKTCTRL0_LENGTH_CONFIG_FIXED)
+	}
+}
+
+// switchLength switches to fixed-length mode, if setLength requires it,
+// once fewer than 256 bytes of the packet remain to be sent or received.
+// The packet then ends when the packet handler's byte counter,
+// which wraps around modulo 256, reaches PKTLEN.
+func (r *Radio) switchLength(remaining int) {
+	if !r.lengthSwitch || remaining > 0xFF {
+		return
+	}
+	r.setLengthConfig(PKTCTRL0_LENGTH_CONFIG_FIXED)
+	r.lengthSwitch = false
+}
+
+// resetLength restores infinite-length mode at the end of a packet,
+// without clearing the error state.
+func (r *Radio) resetLength() {
+	r.lengthSwitch = false
+	err := r.error()
+	r.setError(nil)
+	r.setLengthConfig(PKTCTRL0_LENGTH_CONFIG_INFINITE)
+	if err != nil {
+		r.setError(err)
+	}
+}
+
+func (r *Radio) setLengthConfig(lengthConfig byte) {
+	pktctrl0 := r.hw.ReadRegister(PKTCTRL0)
+	r.hw.WriteRegister(PKTCTRL0, pktctrl0&^0x3|lengthConfig)
+}
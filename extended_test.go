@@ -0,0 +1,112 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExtendedFrame(t *testing.T) {
+	cases := []struct {
+		n    int
+		size int
+	}{
+		{0, minExtendedFrame},
+		{1, minExtendedFrame},
+		{minExtendedFrame - 2, minExtendedFrame},
+		{minExtendedFrame - 1, minExtendedFrame + 1},
+		{1000, 1002},
+	}
+	for _, c := range cases {
+		packet := extendedFrame(binaryPacket(c.n))
+		if len(packet) != c.size {
+			t.Errorf("extendedFrame(%d bytes) has %d bytes, want %d", c.n, len(packet), c.size)
+			continue
+		}
+		if n := int(packet[0])<<8 | int(packet[1]); n != c.n {
+			t.Errorf("extendedFrame(%d bytes) has length field %d", c.n, n)
+		}
+	}
+}
+
+func TestExtendedLength(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(ExtendedLength, 4096, true)
+	before := e.Configuration()
+	for _, n := range []int{1, 100, 254, 255, 256, 300, 511, 512, 1000, 4096} {
+		data := binaryPacket(n)
+		r.Send(data)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		sent := e.Transmitted()
+		if len(sent) != 1 || !bytes.Equal(sent[0], extendedFrame(data)) {
+			t.Errorf("%d bytes: transmitted %d packets, want 1 of %d bytes", n, len(sent), extendedFrameSize(n))
+		}
+		e.Inject(extendedFrame(data))
+		p := r.ReceivePacket(time.Second)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if !bytes.Equal(p.Data, data) || !p.CRCOK {
+			t.Errorf("%d bytes: received %d bytes (CRCOK = %v), want %d", n, len(p.Data), p.CRCOK, n)
+		}
+		if c := e.Configuration(); c.PKTCTRL0 != before.PKTCTRL0 {
+			t.Errorf("%d bytes: PKTCTRL0 == %02X, want %02X", n, c.PKTCTRL0, before.PKTCTRL0)
+		}
+		if r.ReadState() != STATE_IDLE {
+			t.Errorf("%d bytes: state == %s, want IDLE", n, r.State())
+		}
+	}
+	// ReceiveContext must allow time for the longest packet.
+	if d, want := r.maxPacketTime(), (4096+2+numStatusBytes)*r.byteTime(); d < want {
+		t.Errorf("maxPacketTime() == %v, want at least %v", d, want)
+	}
+	// A packet longer than the maximum length is discarded.
+	e.Inject(extendedFrame(binaryPacket(4097)))
+	if p := r.ReceivePacket(100 * time.Millisecond); p.Data != nil {
+		t.Errorf("received %d-byte packet, want nothing", len(p.Data))
+	}
+}
+
+func TestLongZeroTerminated(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	r.SetPacketFormat(ZeroTerminated, 1000, false)
+	data := testPacket(1000)
+	r.Send(data)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	want := append(data, 0, 0)
+	sent := e.Transmitted()
+	if len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("transmitted %d packets, want 1 of %d bytes", len(sent), len(want))
+	}
+	e.Inject(append(data, 0))
+	p, _ := r.Receive(time.Second)
+	if !bytes.Equal(p, data) {
+		t.Errorf("received %d bytes, want %d", len(p), len(data))
+	}
+	// SendAndReceive sends ZeroTerminated packets with a known length,
+	// switching from infinite- to fixed-length mode.
+	request := testPacket(600)
+	e.Inject(append(data[:100], 0))
+	e.StateTrace()
+	p, _ = r.SendAndReceive(request, time.Second)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	sent = e.Transmitted()
+	if len(sent) != 1 || !bytes.Equal(sent[0], append(request, 0, 0)) {
+		t.Errorf("transmitted %d packets, want 1 of %d bytes", len(sent), len(request)+2)
+	}
+	if !bytes.Equal(p, data[:100]) {
+		t.Errorf("received %d bytes, want 100", len(p))
+	}
+	trace := e.StateTrace()
+	if want := []byte{STATE_TX, STATE_RX, STATE_IDLE}; !bytes.Equal(trace, want) {
+		t.Errorf("state trace == %v, want %v", stateNames(trace), stateNames(want))
+	}
+}
@@ -3,7 +3,7 @@ module github.com/ecc1/cc1101
 go 1.13
 
 require (
-	github.com/ecc1/gpio v0.0.0-20230226182448-afe57342d422 // indirect
+	github.com/ecc1/gpio v0.0.0-20230226182448-afe57342d422
 	github.com/ecc1/radio v0.0.0-20230226182625-a0856dd1b465
 	github.com/ecc1/spi v0.0.0-20230226182530-b0f4c20d714a // indirect
 )
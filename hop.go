@@ -0,0 +1,181 @@
+package cc1101
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCalibrationTimeout indicates that the frequency synthesizer
+// did not finish calibrating after an SCAL command.
+var ErrCalibrationTimeout = errors.New("frequency synthesizer calibration timed out")
+
+// ErrNoChannels is returned by NewHopSequence for an empty channel list.
+var ErrNoChannels = errors.New("no channels in hop sequence")
+
+// Maximum time to wait for a manual calibration,
+// which takes about 720 µs.
+const calibrateTimeout = 10 * time.Millisecond
+
+// fscal holds the FSCAL3, FSCAL2, and FSCAL1 calibration results for a channel.
+type fscal [3]byte
+
+// CalibrateChannels calibrates the frequency synthesizer with SCAL
+// for each of the given channels, caches the results, and disables
+// automatic calibration (MCSM0.FS_AUTOCAL), so that SetChannel
+// can retune without recalibrating.
+// See section 28.2 of the data sheet.
+// The cache is discarded by SetFrequency, which restores
+// automatic calibration, and by WriteConfiguration and InitRF.
+// The radio is left in IDLE state on the last channel.
+func (r *Radio) CalibrateChannels(channels []byte) {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return
+	}
+	r.changeState(SIDLE, STATE_IDLE)
+	if r.fscal == nil {
+		r.autocal = r.hw.ReadRegister(MCSM0) & MCSM0_FS_AUTOCAL_TO_IDLE_EVERY_4
+		r.fscal = make(map[byte]fscal)
+	}
+	for _, ch := range channels {
+		r.hw.WriteRegister(CHANNR, ch)
+		r.calibrate(ch)
+		if r.error() != nil {
+			return
+		}
+	}
+	mcsm0 := r.hw.ReadRegister(MCSM0)
+	r.hw.WriteRegister(MCSM0, mcsm0&^MCSM0_FS_AUTOCAL_TO_IDLE_EVERY_4|MCSM0_FS_AUTOCAL_NEVER)
+}
+
+// calibrate performs a manual calibration in IDLE state
+// and caches the results for the given channel.
+func (r *Radio) calibrate(ch byte) {
+	r.strobe(SCAL)
+	deadline := time.Now().Add(calibrateTimeout)
+	for r.readState() != STATE_IDLE && r.error() == nil {
+		if time.Now().After(deadline) {
+			r.setError(ErrCalibrationTimeout)
+			return
+		}
+	}
+	v := r.hw.ReadBurst(FSCAL3, len(fscal{}))
+	if r.error() != nil {
+		return
+	}
+	var cal fscal
+	copy(cal[:], v)
+	r.fscal[ch] = cal
+}
+
+// SetChannel tunes the radio to the given channel, leaving it in IDLE state.
+// If CalibrateChannels has been used, the cached calibration results
+// for the channel are written to the FSCAL registers, after calibrating
+// and caching the channel first if necessary. Otherwise the frequency
+// synthesizer is calibrated according to MCSM0.FS_AUTOCAL.
+func (r *Radio) SetChannel(ch byte) {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return
+	}
+	r.changeState(SIDLE, STATE_IDLE)
+	r.hw.WriteRegister(CHANNR, ch)
+	if r.fscal == nil {
+		return
+	}
+	cal, ok := r.fscal[ch]
+	if !ok {
+		r.calibrate(ch)
+		return
+	}
+	r.hw.WriteBurst(FSCAL3, cal[:])
+}
+
+// Channel returns the radio's current channel number.
+func (r *Radio) Channel() byte {
+	r.hold()
+	defer r.release()
+	return r.hw.ReadRegister(CHANNR)
+}
+
+// clearCalibration discards the calibration cache,
+// restoring automatic calibration if restore is true.
+func (r *Radio) clearCalibration(restore bool) {
+	if r.fscal == nil {
+		return
+	}
+	r.fscal = nil
+	if restore {
+		mcsm0 := r.hw.ReadRegister(MCSM0)
+		r.hw.WriteRegister(MCSM0, mcsm0&^MCSM0_FS_AUTOCAL_TO_IDLE_EVERY_4|r.autocal)
+	}
+}
+
+// HopSequence generates a pseudo-random sequence of channels
+// for frequency hopping. Each cycle of the sequence visits every channel
+// in the list once, in a shuffled order, and the same channel is never
+// used twice in a row (unless there is only one).
+// The sequence depends only on the channel list and the seed,
+// so both ends of a link can generate it independently.
+type HopSequence struct {
+	channels []byte
+	order    []byte
+	next     int
+	state    uint32
+}
+
+// NewHopSequence returns a hop sequence over the given channels.
+// It returns ErrNoChannels if the list is empty.
+func NewHopSequence(channels []byte, seed uint32) (*HopSequence, error) {
+	if len(channels) == 0 {
+		return nil, ErrNoChannels
+	}
+	if seed == 0 {
+		// Xorshift generators must not have a zero state.
+		seed = 0x9E3779B9
+	}
+	s := &HopSequence{
+		channels: append([]byte(nil), channels...),
+		order:    make([]byte, len(channels)),
+		state:    seed,
+	}
+	s.shuffle()
+	return s, nil
+}
+
+// Next returns the next channel in the sequence.
+func (s *HopSequence) Next() byte {
+	if s.next == len(s.order) {
+		last := s.order[len(s.order)-1]
+		s.shuffle()
+		if s.order[0] == last && len(s.order) > 1 {
+			s.order[0], s.order[len(s.order)-1] = s.order[len(s.order)-1], s.order[0]
+		}
+	}
+	ch := s.order[s.next]
+	s.next++
+	return ch
+}
+
+// shuffle starts a new cycle using a Fisher-Yates shuffle.
+func (s *HopSequence) shuffle() {
+	copy(s.order, s.channels)
+	for i := len(s.order) - 1; i > 0; i-- {
+		j := s.random() % uint32(i+1)
+		s.order[i], s.order[j] = s.order[j], s.order[i]
+	}
+	s.next = 0
+}
+
+// random returns the next value of a 32-bit xorshift generator
+// (Marsaglia, "Xorshift RNGs", 2003).
+func (s *HopSequence) random() uint32 {
+	x := s.state
+	x ^= x << 13
+	x ^= x >> 17
+	x ^= x << 5
+	s.state = x
+	return x
+}
@@ -0,0 +1,127 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCalibrateChannels(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	mcsm0 := e.Configuration().MCSM0
+	channels := []byte{0, 5, 10}
+	r.CalibrateChannels(channels)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if n := e.Calibrations(); n != len(channels) {
+		t.Errorf("%d calibrations, want %d", n, len(channels))
+	}
+	if c := e.Configuration(); c.MCSM0&MCSM0_FS_AUTOCAL_TO_IDLE_EVERY_4 != MCSM0_FS_AUTOCAL_NEVER {
+		t.Errorf("MCSM0 == %02X, want autocalibration disabled", c.MCSM0)
+	}
+	fscal := func() []byte {
+		c := e.Configuration()
+		return []byte{c.FSCAL3, c.FSCAL2, c.FSCAL1}
+	}
+	// The last channel calibrated is still in the FSCAL registers.
+	cal10 := fscal()
+	r.SetChannel(5)
+	if ch := r.Channel(); ch != 5 {
+		t.Errorf("channel == %d, want 5", ch)
+	}
+	cal5 := fscal()
+	if bytes.Equal(cal5, cal10) {
+		t.Errorf("FSCAL registers unchanged by SetChannel")
+	}
+	r.SetChannel(10)
+	if !bytes.Equal(fscal(), cal10) {
+		t.Errorf("FSCAL == % X, want cached % X", fscal(), cal10)
+	}
+	// Hopping, sending, and receiving do not recalibrate.
+	for _, ch := range []byte{0, 5, 10, 5} {
+		r.SetChannel(ch)
+		r.Send(testPacket(10))
+		r.ReceivePacket(time.Millisecond)
+		r.SetError(nil)
+		r.SendAndReceive(testPacket(10), time.Millisecond)
+		r.SetError(nil)
+	}
+	if n := e.Calibrations(); n != 0 {
+		t.Errorf("%d calibrations while hopping, want 0", n)
+	}
+	// An uncached channel is calibrated once.
+	r.SetChannel(7)
+	r.SetChannel(5)
+	r.SetChannel(7)
+	if n := e.Calibrations(); n != 1 {
+		t.Errorf("%d calibrations for new channel, want 1", n)
+	}
+	// SetFrequency restores automatic calibration.
+	r.SetFrequency(916700000)
+	if c := e.Configuration(); c.MCSM0 != mcsm0 {
+		t.Errorf("MCSM0 == %02X, want %02X", c.MCSM0, mcsm0)
+	}
+	r.SetChannel(5)
+	r.Send(testPacket(10))
+	if n := e.Calibrations(); n != 1 {
+		t.Errorf("%d calibrations after SetFrequency, want 1", n)
+	}
+	if r.Error() != nil {
+		t.Error(r.Error())
+	}
+}
+
+func TestHopSequence(t *testing.T) {
+	channels := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	newSequence := func(channels []byte, seed uint32) *HopSequence {
+		s, err := NewHopSequence(channels, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	s1 := newSequence(channels, 12345)
+	s2 := newSequence(channels, 12345)
+	s3 := newSequence(channels, 54321)
+	var seq1, seq3 []byte
+	for i := 0; i < 100*len(channels); i++ {
+		ch := s1.Next()
+		if ch2 := s2.Next(); ch2 != ch {
+			t.Fatalf("hop %d: sequences with the same seed differ (%d, %d)", i, ch, ch2)
+		}
+		if i != 0 && ch == seq1[i-1] {
+			t.Errorf("hop %d: channel %d repeated", i, ch)
+		}
+		seq1 = append(seq1, ch)
+		seq3 = append(seq3, s3.Next())
+	}
+	if bytes.Equal(seq1, seq3) {
+		t.Errorf("sequences with different seeds are the same")
+	}
+	// Each cycle uses every channel once.
+	for i := 0; i < len(seq1); i += len(channels) {
+		used := make(map[byte]bool)
+		for _, ch := range seq1[i : i+len(channels)] {
+			used[ch] = true
+		}
+		if len(used) != len(channels) {
+			t.Errorf("cycle %d uses %d channels, want %d", i/len(channels), len(used), len(channels))
+		}
+	}
+	// The sequence must not change, since both ends depend on it.
+	want := []byte{1, 8, 2, 4, 7, 6, 5, 9, 3, 0, 4, 2, 5, 0, 1, 8, 9, 7, 3, 6}
+	if !bytes.Equal(seq1[:len(want)], want) {
+		t.Errorf("sequence starts % d, want % d", seq1[:len(want)], want)
+	}
+	one := newSequence([]byte{42}, 0)
+	for i := 0; i < 3; i++ {
+		if ch := one.Next(); ch != 42 {
+			t.Errorf("single-channel sequence returned %d", ch)
+		}
+	}
+	if _, err := NewHopSequence(nil, 1); err != ErrNoChannels {
+		t.Errorf("NewHopSequence with no channels: error == %v, want %v", err, ErrNoChannels)
+	}
+}
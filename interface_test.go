@@ -10,4 +10,10 @@ var (
 
 	// Ensure that *hwFlavor implements the radio.HardwareFlavor interface.
 	_ radio.HardwareFlavor = (*hwFlavor)(nil)
+
+	// Ensure that spiHardware implements the Hardware interface.
+	_ Hardware = spiHardware{}
+
+	// Ensure that *Emulator implements the Hardware interface.
+	_ Hardware = (*Emulator)(nil)
 )
@@ -0,0 +1,123 @@
+package cc1101
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrBusy is returned by ReadStatus when a long operation,
+// such as sending or receiving a packet, is in progress.
+var ErrBusy = errors.New("radio busy")
+
+// A Radio may be used by multiple goroutines.
+// Its exported methods are serialized by a lock,
+// which is held for the whole of a long operation
+// (Send, Receive, and their variants, or a Stream)
+// and for the duration of a register access otherwise.
+// Operations wait their turn in the order they were started,
+// so short ones queue behind a long one; ReadStatus instead
+// reports ErrBusy, so that monitoring code is not blocked
+// while the radio is sending or receiving.
+type lock struct {
+	mu        sync.Mutex
+	cond      sync.Cond
+	next      uint64 // next ticket to be issued
+	serving   uint64 // ticket of the current or next owner
+	held      bool
+	long      bool
+	published error // error state as of the last release
+}
+
+func newRadio(hw Hardware) *Radio {
+	r := &Radio{
+		hw:    hw,
+		snd:   make([]byte, 1),
+		rcv:   make([]byte, 1),
+		fxosc: FXOSC,
+	}
+	r.cond.L = &r.mu
+	return r
+}
+
+// hold waits until the radio is available and takes ownership of it,
+// waking it if it is asleep.
+func (r *Radio) hold() {
+	r.mu.Lock()
+	r.wait()
+	r.mu.Unlock()
+	r.wake()
+}
+
+// wait takes a ticket and waits for its turn. r.mu must be held.
+func (r *Radio) wait() {
+	ticket := r.next
+	r.next++
+	for r.serving != ticket {
+		r.cond.Wait()
+	}
+	r.held = true
+}
+
+// holdLong is like hold, but marks the operation as a long one.
+func (r *Radio) holdLong() {
+	r.hold()
+	r.mu.Lock()
+	r.long = true
+	r.mu.Unlock()
+}
+
+// tryHold is like hold, but returns false instead of waiting
+// if a long operation is in progress.
+func (r *Radio) tryHold() bool {
+	r.mu.Lock()
+	if r.long {
+		r.mu.Unlock()
+		return false
+	}
+	r.wait()
+	r.mu.Unlock()
+	r.wake()
+	return true
+}
+
+// release publishes the error state and gives up ownership of the radio.
+func (r *Radio) release() {
+	err := r.error()
+	r.mu.Lock()
+	r.published = err
+	r.held = false
+	r.long = false
+	r.serving++
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+// Status contains a snapshot of the radio's state.
+type Status struct {
+	State      byte // chip state, as returned by ReadState
+	MARCState  byte // main radio control state machine state
+	RSSI       int  // received signal strength in dBm
+	NumRXBytes byte // number of bytes in the RXFIFO
+	NumTXBytes byte // number of bytes in the TXFIFO
+}
+
+// ReadStatus reads the radio's status registers.
+// Unlike the other methods, it does not wait for a long operation
+// to finish, but returns ErrBusy instead.
+// Otherwise it returns the radio's error state.
+func (r *Radio) ReadStatus() (Status, error) {
+	if !r.tryHold() {
+		return Status{}, ErrBusy
+	}
+	defer r.release()
+	var s Status
+	if err := r.error(); err != nil {
+		return s, err
+	}
+	s.State = r.readState()
+	s.MARCState = r.hw.ReadRegister(MARCSTATE) & MARCSTATE_MASK
+	s.RSSI = r.readRSSI()
+	s.NumRXBytes = r.readNumRXBytes()
+	s.NumTXBytes = r.readNumTXBytes()
+	return s, r.error()
+}
@@ -0,0 +1,116 @@
+package cc1101
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadStatus(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	e.SetRSSI(-80)
+	s, err := r.ReadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.State != STATE_IDLE || s.NumRXBytes != 0 || s.NumTXBytes != 0 {
+		t.Errorf("status == %+v, want IDLE with empty FIFOs", s)
+	}
+	if s.RSSI != -80 {
+		t.Errorf("RSSI == %d, want -80", s.RSSI)
+	}
+	r.SetError(ErrChannelBusy)
+	if _, err := r.ReadStatus(); err != ErrChannelBusy {
+		t.Errorf("ReadStatus error == %v, want ErrChannelBusy", err)
+	}
+}
+
+// TestBusy checks that ReadStatus is rejected while a long operation
+// holds the radio, and that other operations wait for it to finish.
+func TestBusy(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	received := make(chan Packet)
+	go func() {
+		p, _ := r.ReceiveContext(context.Background())
+		received <- p
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := r.ReadStatus()
+		if err == ErrBusy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ReadStatus error == %v, want ErrBusy", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if r.Error() != nil {
+		t.Errorf("Error() == %v during receive", r.Error())
+	}
+	// ReadState waits until the packet has been received.
+	state := make(chan byte)
+	go func() { state <- r.ReadState() }()
+	select {
+	case s := <-state:
+		t.Fatalf("ReadState returned %s during receive", StateName(s))
+	case <-time.After(50 * time.Millisecond):
+	}
+	data := testPacket(50)
+	e.Inject(append(data, 0))
+	p := <-received
+	if !bytes.Equal(p.Data, data) {
+		t.Errorf("received % X, want % X", p.Data, data)
+	}
+	if s := <-state; s != STATE_IDLE {
+		t.Errorf("state == %s, want IDLE", StateName(s))
+	}
+	if _, err := r.ReadStatus(); err != nil {
+		t.Errorf("ReadStatus error == %v after receive", err)
+	}
+}
+
+// TestConcurrentUse is intended to be run with the race detector.
+func TestConcurrentUse(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 60, true)
+	data := binaryPacket(40)
+	frame := append([]byte{byte(len(data))}, data...)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			r.Send(data)
+			e.Inject(frame)
+			r.Receive(10 * time.Millisecond)
+			r.Receive(time.Millisecond)
+			r.SetError(nil)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			r.ReadStatus()
+			r.ReadRSSI()
+			r.Error()
+			r.Frequency()
+		}
+	}()
+	wg.Wait()
+	if n := len(e.Transmitted()); n != 20 {
+		t.Errorf("transmitted %d packets, want 20", n)
+	}
+}
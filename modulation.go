@@ -0,0 +1,155 @@
+package cc1101
+
+import (
+	"fmt"
+)
+
+// Modulation represents the radio's modulation format.
+type Modulation byte
+
+// Modulation formats supported by the radio.
+const (
+	Modulation2FSK Modulation = MDMCFG2_MOD_FORMAT_2_FSK
+	ModulationGFSK Modulation = MDMCFG2_MOD_FORMAT_GFSK
+	ModulationOOK  Modulation = MDMCFG2_MOD_FORMAT_ASK_OOK
+	Modulation4FSK Modulation = MDMCFG2_MOD_FORMAT_4_FSK
+	ModulationMSK  Modulation = MDMCFG2_MOD_FORMAT_MSK
+)
+
+func (mod Modulation) String() string {
+	return modFormat[(mod&MDMCFG2_MOD_FORMAT_MASK)>>4]
+}
+
+func (mod Modulation) valid() bool {
+	switch mod {
+	case Modulation2FSK, ModulationGFSK, ModulationOOK, Modulation4FSK, ModulationMSK:
+		return true
+	default:
+		return false
+	}
+}
+
+// usesDeviation reports whether the DEVIATN register
+// specifies a frequency deviation for the modulation format.
+// For MSK it specifies the phase change instead (see section 16.1 of the data sheet).
+func (mod Modulation) usesDeviation() bool {
+	switch mod {
+	case Modulation2FSK, ModulationGFSK, Modulation4FSK:
+		return true
+	default:
+		return false
+	}
+}
+
+// Above this data rate, the low data rate TEST register values are not used.
+const lowDataRateLimit = 100000 // Baud
+
+// SetModulation sets the radio's modulation format and,
+// for the FSK formats, the frequency deviation in Hertz.
+// It returns the deviation that was achieved, or 0 if not applicable.
+// For OOK, PATABLE entry 0 is used for '0' and entry 1 for '1';
+// for the other formats only entry 0 is used, and the current
+// output power setting is moved to the appropriate entry.
+func (r *Radio) SetModulation(mod Modulation, deviation uint32) uint32 {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return 0
+	}
+	if !mod.valid() {
+		r.setError(fmt.Errorf("invalid modulation format %02X", byte(mod)))
+		return 0
+	}
+	achieved := uint32(0)
+	if mod.usesDeviation() {
+		e, m, err := deviationToRegisters(deviation, r.fxosc)
+		if err != nil {
+			r.setError(err)
+			return 0
+		}
+		r.hw.WriteRegister(DEVIATN, e<<DEVIATN_DEVIATION_E_SHIFT|m<<DEVIATN_DEVIATION_M_SHIFT)
+		achieved = registersToDeviation(e, m, r.fxosc)
+	}
+	m2 := r.hw.ReadRegister(MDMCFG2)
+	r.hw.WriteRegister(MDMCFG2, m2&^MDMCFG2_MOD_FORMAT_MASK|byte(mod))
+	r.setPAPower(mod)
+	r.setTestRegisters()
+	return achieved
+}
+
+// setPAPower sets FREND0.PA_POWER to the PATABLE index used for
+// the given modulation format, and moves the current output setting
+// to that index.
+func (r *Radio) setPAPower(mod Modulation) {
+	paPower := byte(0)
+	if mod == ModulationOOK {
+		paPower = 1
+	}
+	f0 := r.hw.ReadRegister(FREND0)
+	prev := (f0 & FREND0_PA_POWER_MASK) >> FREND0_PA_POWER_SHIFT
+	if prev != paPower {
+		pa := r.readPATable()
+		if r.error() != nil {
+			return
+		}
+		if paPower == 0 {
+			r.hw.WriteBurst(PATABLE, []byte{pa[prev]})
+		} else {
+			r.hw.WriteBurst(PATABLE, []byte{0x00, pa[prev]})
+		}
+	}
+	r.hw.WriteRegister(FREND0, f0&^FREND0_PA_POWER_MASK|paPower<<FREND0_PA_POWER_SHIFT)
+}
+
+// setTestRegisters sets TEST2 and TEST1 for the current data rate,
+// using the values recommended by SmartRF Studio.
+func (r *Radio) setTestRegisters() {
+	_, drate := r.readChannelParams()
+	if drate <= lowDataRateLimit {
+		r.hw.WriteBurst(TEST2, []byte{TEST2_RX_LOW_DATA_RATE_MAGIC, TEST1_RX_LOW_DATA_RATE_MAGIC})
+	} else {
+		r.hw.WriteBurst(TEST2, []byte{TEST2_NORMAL_MAGIC, TEST1_TX_MAGIC})
+	}
+}
+
+// ReadModulation returns the radio's modulation format
+// and frequency deviation in Hertz (0 if not applicable).
+func (r *Radio) ReadModulation() (Modulation, uint32) {
+	r.hold()
+	defer r.release()
+	return r.readModulation()
+}
+
+func (r *Radio) readModulation() (Modulation, uint32) {
+	mod := Modulation(r.hw.ReadRegister(MDMCFG2) & MDMCFG2_MOD_FORMAT_MASK)
+	if !mod.usesDeviation() {
+		return mod, 0
+	}
+	d := r.hw.ReadRegister(DEVIATN)
+	e := (d >> DEVIATN_DEVIATION_E_SHIFT) & 0x7
+	m := (d >> DEVIATN_DEVIATION_M_SHIFT) & 0x7
+	return mod, registersToDeviation(e, m, r.fxosc)
+}
+
+func registersToDeviation(e, m byte, fxosc uint32) uint32 {
+	return uint32(((8 + uint64(m)) << e * uint64(fxosc)) >> 17)
+}
+
+// deviationToRegisters returns the DEVIATION_E and DEVIATION_M values
+// closest to the given frequency deviation.
+func deviationToRegisters(deviation uint32, fxosc uint32) (byte, byte, error) {
+	min := registersToDeviation(0, 0, fxosc)
+	max := registersToDeviation(7, 7, fxosc)
+	if deviation < min || deviation > max {
+		return 0, 0, RangeError{Name: "deviation", Value: deviation, Min: min, Max: max}
+	}
+	bestE, bestM := byte(0), byte(0)
+	for e := byte(0); e < 8; e++ {
+		for m := byte(0); m < 8; m++ {
+			if absDiff(registersToDeviation(e, m, fxosc), deviation) < absDiff(registersToDeviation(bestE, bestM, fxosc), deviation) {
+				bestE, bestM = e, m
+			}
+		}
+	}
+	return bestE, bestM, nil
+}
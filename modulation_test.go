@@ -0,0 +1,92 @@
+package cc1101
+
+import (
+	"testing"
+)
+
+func TestDeviation(t *testing.T) {
+	cases := []struct {
+		fxosc     uint32
+		deviation uint32
+		e, m      byte
+		achieved  uint32
+	}{
+		{24000000, 1464, 0, 0, 1464},
+		{24000000, 5000, 1, 6, 5126},
+		{24000000, 20000, 3, 6, 20507},
+		{24000000, 47607, 5, 0, 46875},
+		{24000000, 351562, 7, 7, 351562},
+		{26000000, 1587, 0, 0, 1586},
+		{26000000, 47607, 4, 7, 47607},
+		{26000000, 20629, 3, 5, 20629},
+	}
+	for _, c := range cases {
+		e, m, err := deviationToRegisters(c.deviation, c.fxosc)
+		if err != nil {
+			t.Errorf("deviationToRegisters(%d, %d): %v", c.deviation, c.fxosc, err)
+			continue
+		}
+		if e != c.e || m != c.m {
+			t.Errorf("deviationToRegisters(%d, %d) == (%d, %d), want (%d, %d)", c.deviation, c.fxosc, e, m, c.e, c.m)
+		}
+		d := registersToDeviation(c.e, c.m, c.fxosc)
+		if d != c.achieved {
+			t.Errorf("registersToDeviation(%d, %d, %d) == %d, want %d", c.e, c.m, c.fxosc, d, c.achieved)
+		}
+	}
+	for _, d := range []uint32{0, 1000, 400000} {
+		_, _, err := deviationToRegisters(d, FXOSC)
+		if _, ok := err.(RangeError); !ok {
+			t.Errorf("deviationToRegisters(%d) error == %v, want RangeError", d, err)
+		}
+	}
+}
+
+func TestSetModulation(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	cases := []struct {
+		mod       Modulation
+		deviation uint32
+		achieved  uint32
+		paPower   byte
+		patable   []byte
+	}{
+		{ModulationGFSK, 20000, 20507, 0, []byte{0xC0}},
+		{Modulation2FSK, 47607, 46875, 0, []byte{0xC0}},
+		{ModulationOOK, 0, 0, 1, []byte{0x00, 0xC0}},
+		{Modulation4FSK, 5000, 5126, 0, []byte{0xC0}},
+		{ModulationMSK, 0, 0, 0, []byte{0xC0}},
+	}
+	for _, c := range cases {
+		achieved := r.SetModulation(c.mod, c.deviation)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if achieved != c.achieved {
+			t.Errorf("SetModulation(%v, %d) == %d, want %d", c.mod, c.deviation, achieved, c.achieved)
+		}
+		mod, _ := r.ReadModulation()
+		if mod != c.mod {
+			t.Errorf("ReadModulation() == %v, want %v", mod, c.mod)
+		}
+		rf := e.Configuration()
+		if p := rf.FREND0 & FREND0_PA_POWER_MASK; p != c.paPower {
+			t.Errorf("%v: PA_POWER == %d, want %d", c.mod, p, c.paPower)
+		}
+		pa := r.ReadPATable()
+		for i, v := range c.patable {
+			if pa[i] != v {
+				t.Errorf("%v: PATABLE == % X, want % X", c.mod, pa, c.patable)
+				break
+			}
+		}
+		if rf.TEST2 != TEST2_RX_LOW_DATA_RATE_MAGIC || rf.TEST1 != TEST1_RX_LOW_DATA_RATE_MAGIC {
+			t.Errorf("%v: TEST2, TEST1 == %02X %02X, want low data rate values", c.mod, rf.TEST2, rf.TEST1)
+		}
+	}
+	r.SetModulation(Modulation(2<<4), 0)
+	if r.Error() == nil {
+		t.Errorf("SetModulation with invalid format succeeded")
+	}
+}
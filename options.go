@@ -0,0 +1,80 @@
+package cc1101
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Options specifies how the radio module is connected to the host.
+type Options struct {
+	SPIDevice    string // pathname of the SPI device
+	Speed        int    // SPI speed in Hz
+	CustomCS     int    // GPIO to use as a custom chip-select (0 for none)
+	InterruptPin int    // GPIO for receive interrupts
+
+	// Crystal frequency in Hz (0 for FXOSC).
+	CrystalFrequency int
+
+	// Pathname of the calibration profile file ("" for none).
+	Profile string
+}
+
+// Environment variables that override the default options.
+const (
+	SPIDeviceEnv    = "CC1101_SPI_DEVICE"
+	SPISpeedEnv     = "CC1101_SPI_SPEED"
+	CustomCSEnv     = "CC1101_CS_PIN"
+	InterruptPinEnv = "CC1101_INTERRUPT_PIN"
+	CrystalEnv      = "CC1101_CRYSTAL"
+)
+
+// DefaultOptions returns the options for the board this package was built for.
+func DefaultOptions() Options {
+	return Options{
+		SPIDevice:    spiDevice,
+		Speed:        spiSpeed,
+		CustomCS:     customCS,
+		InterruptPin: interruptPin,
+
+		CrystalFrequency: FXOSC,
+	}
+}
+
+// EnvironmentOptions returns the default options,
+// overridden by any of the CC1101_* environment variables that are set.
+func EnvironmentOptions() (Options, error) {
+	opts := DefaultOptions()
+	if s := os.Getenv(SPIDeviceEnv); s != "" {
+		opts.SPIDevice = s
+	}
+	if s := os.Getenv(ProfileEnv); s != "" {
+		opts.Profile = s
+	}
+	ints := []struct {
+		name string
+		val  *int
+	}{
+		{SPISpeedEnv, &opts.Speed},
+		{CustomCSEnv, &opts.CustomCS},
+		{InterruptPinEnv, &opts.InterruptPin},
+		{CrystalEnv, &opts.CrystalFrequency},
+	}
+	for _, v := range ints {
+		s := os.Getenv(v.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("%s: invalid value %q", v.name, s)
+		}
+		*v.val = n
+	}
+	if opts.CrystalFrequency != 0 {
+		if err := checkCrystalFrequency(float64(opts.CrystalFrequency)); err != nil {
+			return opts, fmt.Errorf("%s: %v", CrystalEnv, err)
+		}
+	}
+	return opts, nil
+}
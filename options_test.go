@@ -0,0 +1,105 @@
+package cc1101
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEnvironmentOptions(t *testing.T) {
+	vars := []string{SPIDeviceEnv, SPISpeedEnv, CustomCSEnv, InterruptPinEnv, CrystalEnv, ProfileEnv}
+	for _, v := range vars {
+		defer os.Setenv(v, os.Getenv(v))
+	}
+	cases := []struct {
+		env  map[string]string
+		opts Options
+		ok   bool
+	}{
+		{map[string]string{}, DefaultOptions(), true},
+		{
+			map[string]string{
+				SPIDeviceEnv:    "/dev/spidev1.0",
+				SPISpeedEnv:     "4000000",
+				CustomCSEnv:     "7",
+				InterruptPinEnv: "25",
+				CrystalEnv:      "26000000",
+				ProfileEnv:      "/etc/cc1101.json",
+			},
+			Options{SPIDevice: "/dev/spidev1.0", Speed: 4000000, CustomCS: 7, InterruptPin: 25, CrystalFrequency: 26000000, Profile: "/etc/cc1101.json"},
+			true,
+		},
+		{map[string]string{SPISpeedEnv: "fast"}, Options{}, false},
+		{map[string]string{InterruptPinEnv: "-1"}, Options{}, false},
+		{map[string]string{CrystalEnv: "1000"}, Options{}, false},
+	}
+	for _, c := range cases {
+		for _, v := range vars {
+			os.Setenv(v, c.env[v])
+		}
+		opts, err := EnvironmentOptions()
+		if !c.ok {
+			if err == nil {
+				t.Errorf("EnvironmentOptions() with %v succeeded, want error", c.env)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("EnvironmentOptions() with %v: %v", c.env, err)
+			continue
+		}
+		if opts != c.opts {
+			t.Errorf("EnvironmentOptions() with %v == %+v, want %+v", c.env, opts, c.opts)
+		}
+	}
+}
+
+func TestOpenError(t *testing.T) {
+	vars := []string{SPIDeviceEnv, SPISpeedEnv}
+	for _, v := range vars {
+		defer os.Setenv(v, os.Getenv(v))
+	}
+	const device = "/nonexistent/spidev0.0"
+	os.Setenv(SPIDeviceEnv, device)
+	os.Setenv(SPISpeedEnv, "fast")
+	opts := DefaultOptions()
+	opts.SPIDevice = device
+	for _, r := range []*Radio{Open(), OpenWith(opts)} {
+		if r.Error() == nil {
+			t.Errorf("opening %s succeeded", device)
+			continue
+		}
+		// The radio must be safe to use, reporting errors instead of panicking.
+		if d := r.Device(); d != device {
+			t.Errorf("Device() == %q, want %q", d, device)
+		}
+		r.Init(916600000)
+		r.Send(testPacket(10))
+		r.ReceivePacket(time.Millisecond)
+		if r.Error() == nil {
+			t.Errorf("operations on unopened device succeeded")
+		}
+		r.Close()
+	}
+}
+
+// TestPartialOpen opens a device that is not an SPI device,
+// so radio.Open fails after opening it.
+func TestPartialOpen(t *testing.T) {
+	const device = "/dev/null"
+	if _, err := os.Stat(device); err != nil {
+		t.Skip(err)
+	}
+	opts := DefaultOptions()
+	opts.SPIDevice = device
+	r := OpenWith(opts)
+	if r.Error() == nil {
+		t.Fatalf("opening %s succeeded", device)
+	}
+	r.Init(916600000)
+	r.ReceivePacket(time.Millisecond)
+	if r.Error() == nil {
+		t.Errorf("operations on partially opened device succeeded")
+	}
+	r.Close()
+}
@@ -0,0 +1,373 @@
+package cc1101
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// PacketFormat specifies how the radio frames packets.
+type PacketFormat int
+
+const (
+	// ZeroTerminated packets are sent and received in infinite-length
+	// mode and terminated by a zero byte, as used by Medtronic pumps.
+	// Payloads must not contain zero bytes, and may be up to the length
+	// given to SetPacketFormat. This is the format set by InitRF.
+	ZeroTerminated PacketFormat = iota
+
+	// FixedLength packets have the length given to SetPacketFormat.
+	// Shorter payloads are padded with zero bytes.
+	FixedLength
+
+	// VariableLength packets are preceded by a length byte,
+	// and may be up to the length given to SetPacketFormat.
+	VariableLength
+
+	// ExtendedLength packets are preceded by a two-byte length
+	// (most significant byte first), and may be up to the length
+	// given to SetPacketFormat, which can exceed 255 bytes.
+	// They are sent and received by switching from infinite-length
+	// to fixed-length mode near the end of the packet.
+	ExtendedLength
+)
+
+func (f PacketFormat) String() string {
+	switch f {
+	case ZeroTerminated:
+		return "zero-terminated"
+	case FixedLength:
+		return "fixed-length"
+	case VariableLength:
+		return "variable-length"
+	case ExtendedLength:
+		return "extended-length"
+	default:
+		return fmt.Sprintf("PacketFormat(%d)", int(f))
+	}
+}
+
+// Packet represents a received packet and its metadata.
+type Packet struct {
+	Data    []byte // payload
+	Address byte   // destination address, if address filtering is enabled
+
+	RSSI  int  // signal strength when the sync word was received, in dBm
+	LQI   byte // link quality indicator (lower is better)
+	CRCOK bool // whether the CRC check passed (false if CRC is disabled)
+
+	FrequencyOffset int    // estimated carrier frequency offset, in Hertz
+	Frequency       uint32 // frequency of the channel, in Hertz
+	Channel         byte   // channel number
+
+	Time time.Time // when the sync word was received
+}
+
+// Number of status bytes appended to received packets
+// when PKTCTRL1_APPEND_STATUS is set.
+const numStatusBytes = 2
+
+// SetPacketFormat configures the radio's packet handler.
+// For FixedLength packets, length is the packet length;
+// for the other formats, it is the maximum payload length,
+// up to 255 bytes for VariableLength packets
+// and up to 65535 bytes for the ZeroTerminated and ExtendedLength formats.
+// For ZeroTerminated packets, a length of 0 selects the default maximum.
+// If crc is true, a CRC is appended to sent packets,
+// and received packets that fail the CRC check are discarded.
+// CRC is not supported for ZeroTerminated packets.
+// Address filtering is disabled; use SetAddress to enable it.
+// InitRF resets the format to ZeroTerminated.
+func (r *Radio) SetPacketFormat(format PacketFormat, length int, crc bool) {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return
+	}
+	lengthConfig := byte(PKTCTRL0_LENGTH_CONFIG_INFINITE)
+	pktlen := byte(0)
+	switch format {
+	case ZeroTerminated:
+		if crc {
+			r.setError(fmt.Errorf("CRC is not supported for %v packets", format))
+			return
+		}
+		if length == 0 {
+			length = maxPacketSize
+		}
+		if length < 1 || length > maxExtendedLength {
+			r.setError(fmt.Errorf("invalid %v packet length (%d)", format, length))
+			return
+		}
+	case ExtendedLength:
+		if length < 1 || length > maxExtendedLength {
+			r.setError(fmt.Errorf("invalid %v packet length (%d)", format, length))
+			return
+		}
+	case FixedLength, VariableLength:
+		if length < 1 || length > 255 {
+			r.setError(fmt.Errorf("invalid %v packet length (%d)", format, length))
+			return
+		}
+		pktlen = byte(length)
+		lengthConfig = PKTCTRL0_LENGTH_CONFIG_FIXED
+		if format == VariableLength {
+			lengthConfig = PKTCTRL0_LENGTH_CONFIG_VARIABLE
+		}
+	default:
+		r.setError(fmt.Errorf("invalid packet format %v", format))
+		return
+	}
+	p := r.hw.ReadBurst(PKTLEN, 3)
+	if r.error() != nil {
+		return
+	}
+	pktctrl1 := p[1] &^ (PKTCTRL1_APPEND_STATUS | 0x3)
+	if format != ZeroTerminated {
+		pktctrl1 |= PKTCTRL1_APPEND_STATUS
+	}
+	pktctrl0 := p[2]&^(PKTCTRL0_CRC_EN|0x3) | lengthConfig
+	if crc {
+		pktctrl0 |= PKTCTRL0_CRC_EN
+	}
+	r.hw.WriteBurst(PKTLEN, []byte{pktlen, pktctrl1, pktctrl0})
+	r.packetFormat = format
+	r.packetLength = length
+	r.crc = crc
+	r.addressFilter = AddressCheckNone
+}
+
+// PacketFormat returns the radio's packet format, packet length, and CRC setting.
+func (r *Radio) PacketFormat() (PacketFormat, int, bool) {
+	r.hold()
+	defer r.release()
+	return r.packetFormat, r.packetLength, r.crc
+}
+
+// maxPayload returns the largest payload that can be sent
+// in the current packet format.
+func (r *Radio) maxPayload() int {
+	if r.addressing() {
+		return r.packetLength - 1
+	}
+	return r.packetLength
+}
+
+// frame returns the bytes to be written to the TXFIFO
+// to send the given payload in the current packet format.
+// The destination address is included if address filtering is enabled.
+func (r *Radio) frame(addr byte, data []byte) []byte {
+	if r.addressing() {
+		data = append([]byte{addr}, data...)
+	}
+	switch r.packetFormat {
+	case FixedLength:
+		return resize(data, r.packetLength)
+	case VariableLength:
+		packet := make([]byte, 1+len(data))
+		packet[0] = byte(len(data))
+		copy(packet[1:], data)
+		return packet
+	case ExtendedLength:
+		return extendedFrame(data)
+	default:
+		// Terminate packet with zero byte,
+		// and pad with another to ensure final bytes
+		// are transmitted before leaving TX state.
+		return resize(data, len(data)+2)
+	}
+}
+
+// receiveFramed listens with the given timeout for an incoming packet
+// in fixed- or variable-length mode.
+// Packets that fail the CRC check are discarded.
+func (r *Radio) receiveFramed(timeout time.Duration, wor bool) Packet {
+	deadline := time.Now().Add(timeout)
+	defer r.changeState(SIDLE, STATE_IDLE)
+	for r.error() == nil {
+		r.listen(wor)
+		if verbose {
+			log.Printf("waiting for interrupt in %s state", r.state())
+		}
+		// The deadline may have passed while reading an invalid packet,
+		// and a negative timeout would wait forever.
+		wait := time.Until(deadline)
+		if wait < 0 {
+			wait = 0
+		}
+		r.hw.AwaitInterrupt(wait)
+		t := time.Now()
+		p, ok := r.readPacket(deadline)
+		if r.error() == ErrRXFIFOOverflow {
+			// changeState will flush the RX FIFO.
+			continue
+		}
+		if r.error() != nil {
+			break
+		}
+		p.Time = t
+		r.readPacketInfo(&p)
+		// The radio may still be in RX state if the packet was
+		// incomplete, so return to IDLE before flushing the FIFO.
+		r.changeState(SIDLE, STATE_IDLE)
+		r.strobe(SFRX)
+		if ok {
+			r.trackFrequency()
+			return p
+		}
+		if verbose {
+			log.Printf("discarding packet")
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+	}
+	return Packet{}
+}
+
+// readPacket reads a packet from the RXFIFO,
+// waiting until the given deadline for it to be received.
+// It returns the packet, with the metadata from the appended status bytes,
+// and whether the packet is valid.
+func (r *Radio) readPacket(deadline time.Time) (Packet, bool) {
+	r.receiveBuffer.Reset()
+	defer r.receiveBuffer.Reset()
+	total := -1
+	switch r.packetFormat {
+	case FixedLength:
+		total = r.packetLength + numStatusBytes
+	case ExtendedLength:
+		defer r.resetLength()
+	}
+	for r.error() == nil {
+		if total < 0 && r.receiveBuffer.Len() >= r.lengthFieldSize() {
+			n := r.lengthField(r.receiveBuffer.Bytes())
+			if n > r.packetLength {
+				return Packet{}, false
+			}
+			total = r.frameSize(n) + numStatusBytes
+			if r.packetFormat == ExtendedLength {
+				// The packet was started in infinite-length mode.
+				r.hw.WriteRegister(PKTLEN, byte(total-numStatusBytes))
+				r.lengthSwitch = true
+			}
+		}
+		remaining := total - r.receiveBuffer.Len()
+		if remaining == 0 {
+			break
+		}
+		numBytes := int(r.readNumRXBytes())
+		if r.error() != nil {
+			return Packet{}, false
+		}
+		if total >= 0 {
+			r.switchLength(remaining - numStatusBytes - numBytes)
+		}
+		// Don't read last byte of FIFO if packet is still
+		// being received. See Section 20 of data sheet.
+		n := numBytes - 1
+		if total >= 0 && numBytes >= remaining {
+			n = remaining
+		}
+		if n < 1 {
+			if time.Now().After(deadline) {
+				return Packet{}, false
+			}
+			time.Sleep(byteDuration)
+			continue
+		}
+		data := r.hw.ReadBurst(RXFIFO, n)
+		if r.error() != nil {
+			return Packet{}, false
+		}
+		_, r.err = r.receiveBuffer.Write(data)
+	}
+	if r.error() != nil {
+		return Packet{}, false
+	}
+	return r.decodePacket(r.receiveBuffer.Bytes())
+}
+
+// lengthFieldSize returns the size of the length field
+// at the start of packets in the current packet format.
+func (r *Radio) lengthFieldSize() int {
+	switch r.packetFormat {
+	case VariableLength:
+		return 1
+	case ExtendedLength:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// lengthField returns the payload length given by the length field
+// at the start of the given VariableLength or ExtendedLength packet.
+func (r *Radio) lengthField(data []byte) int {
+	if r.packetFormat == ExtendedLength {
+		return int(data[0])<<8 | int(data[1])
+	}
+	return int(data[0])
+}
+
+// frameSize returns the number of bytes sent for a packet with an n-byte
+// payload (including any address byte) in the current packet format,
+// excluding the CRC.
+func (r *Radio) frameSize(n int) int {
+	switch r.packetFormat {
+	case FixedLength:
+		return r.packetLength
+	case VariableLength:
+		return 1 + n
+	case ExtendedLength:
+		return extendedFrameSize(n)
+	default:
+		return n
+	}
+}
+
+// decodePacket decodes a packet read from the RXFIFO,
+// consisting of the length byte (in variable-length mode),
+// address byte (if address filtering is enabled), payload,
+// and appended status bytes.
+// It returns the packet and whether it is valid.
+func (r *Radio) decodePacket(data []byte) (Packet, bool) {
+	status := data[len(data)-numStatusBytes:]
+	p := Packet{
+		RSSI:  rssiToDBm(status[0]) + r.profile.RSSIOffset,
+		LQI:   status[1] & PKT_APPEND_STATUS_1_LQI_MASK,
+		CRCOK: r.crc && status[1]&PKT_APPEND_STATUS_1_CRC_OK != 0,
+	}
+	if r.crc && !p.CRCOK {
+		return Packet{}, false
+	}
+	data = data[:len(data)-numStatusBytes]
+	switch r.packetFormat {
+	case VariableLength:
+		data = data[1:]
+	case ExtendedLength:
+		data = data[2 : 2+r.lengthField(data)]
+	}
+	if r.addressing() && len(data) != 0 {
+		p.Address = data[0]
+		data = data[1:]
+	}
+	p.Data = make([]byte, len(data))
+	copy(p.Data, data)
+	return p, true
+}
+
+// readPacketInfo fills in the frequency-related metadata
+// for a packet that has just been received.
+func (r *Radio) readPacketInfo(p *Packet) {
+	p.FrequencyOffset = freqEstToHz(r.hw.ReadRegister(FREQEST), r.fxosc)
+	p.Channel = r.hw.ReadRegister(CHANNR)
+	_, _, chanspc := r.readModemConfig()
+	p.Frequency = r.frequency() + uint32(p.Channel)*chanspc
+}
+
+// freqEstToHz converts a FREQEST value (two's complement,
+// in units of FXOSC/2^14) to a frequency offset in Hertz.
+func freqEstToHz(v byte, fxosc uint32) int {
+	return int(int8(v)) * int(fxosc) / (1 << 14)
+}
@@ -0,0 +1,245 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// binaryPacket returns a packet of the given size containing zero bytes.
+func binaryPacket(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i * 7)
+	}
+	return p
+}
+
+func TestPacketFormatRegisters(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	if format, length, _ := r.PacketFormat(); format != ZeroTerminated || length != maxPacketSize {
+		t.Errorf("PacketFormat() after InitRF == (%v, %d), want (%v, %d)", format, length, ZeroTerminated, maxPacketSize)
+	}
+	cases := []struct {
+		format   PacketFormat
+		length   int
+		crc      bool
+		pktlen   byte
+		pktctrl1 byte
+		pktctrl0 byte
+	}{
+		{FixedLength, 20, false, 20, 4<<PKTCTRL1_PQT_SHIFT | PKTCTRL1_APPEND_STATUS, PKTCTRL0_LENGTH_CONFIG_FIXED},
+		{VariableLength, 61, true, 61, 4<<PKTCTRL1_PQT_SHIFT | PKTCTRL1_APPEND_STATUS, PKTCTRL0_LENGTH_CONFIG_VARIABLE | PKTCTRL0_CRC_EN},
+		{ZeroTerminated, 500, false, 0, 4 << PKTCTRL1_PQT_SHIFT, PKTCTRL0_LENGTH_CONFIG_INFINITE},
+		{ExtendedLength, 4096, true, 0, 4<<PKTCTRL1_PQT_SHIFT | PKTCTRL1_APPEND_STATUS, PKTCTRL0_LENGTH_CONFIG_INFINITE | PKTCTRL0_CRC_EN},
+	}
+	for _, c := range cases {
+		r.SetPacketFormat(c.format, c.length, c.crc)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		rf := e.Configuration()
+		if rf.PKTLEN != c.pktlen || rf.PKTCTRL1 != c.pktctrl1 || rf.PKTCTRL0 != c.pktctrl0 {
+			t.Errorf("%v: PKTLEN, PKTCTRL1, PKTCTRL0 == %02X %02X %02X, want %02X %02X %02X",
+				c.format, rf.PKTLEN, rf.PKTCTRL1, rf.PKTCTRL0, c.pktlen, c.pktctrl1, c.pktctrl0)
+		}
+		format, length, crc := r.PacketFormat()
+		if format != c.format || length != c.length || crc != c.crc {
+			t.Errorf("PacketFormat() == (%v, %d, %v), want (%v, %d, %v)", format, length, crc, c.format, c.length, c.crc)
+		}
+	}
+	invalid := []struct {
+		format PacketFormat
+		length int
+		crc    bool
+	}{
+		{ZeroTerminated, 0, true},
+		{FixedLength, 0, false},
+		{VariableLength, 256, true},
+		{ExtendedLength, maxExtendedLength + 1, false},
+		{PacketFormat(4), 10, false},
+	}
+	for _, c := range invalid {
+		r.SetError(nil)
+		r.SetPacketFormat(c.format, c.length, c.crc)
+		if r.Error() == nil {
+			t.Errorf("SetPacketFormat(%v, %d, %v) succeeded, want error", c.format, c.length, c.crc)
+		}
+	}
+}
+
+func TestFixedLength(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(FixedLength, 20, true)
+	data := binaryPacket(20)
+	r.Send(data)
+	sent := e.Transmitted()
+	if len(sent) != 1 || !bytes.Equal(sent[0], data) {
+		t.Errorf("transmitted % X, want % X", sent, data)
+	}
+	// Short payloads are padded.
+	r.Send(data[:5])
+	sent = e.Transmitted()
+	if len(sent) != 1 || !bytes.Equal(sent[0], resize(data[:5], 20)) {
+		t.Errorf("transmitted % X, want % X", sent, resize(data[:5], 20))
+	}
+	e.Inject(data)
+	p, _ := r.Receive(time.Second)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if !bytes.Equal(p, data) {
+		t.Errorf("received % X, want % X", p, data)
+	}
+}
+
+func TestVariableLength(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 255, true)
+	for _, n := range []int{0, 1, 30, 61, 100, 255} {
+		data := binaryPacket(n)
+		r.Send(data)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		sent := e.Transmitted()
+		want := append([]byte{byte(n)}, data...)
+		if len(sent) != 1 || !bytes.Equal(sent[0], want) {
+			t.Errorf("transmitted % X, want % X", sent, want)
+		}
+		if r.ReadState() != STATE_IDLE {
+			t.Errorf("state after Send == %s, want IDLE", r.State())
+		}
+		e.Inject(want)
+		p, _ := r.Receive(time.Second)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if !bytes.Equal(p, data) {
+			t.Errorf("received % X, want % X", p, data)
+		}
+	}
+}
+
+func TestCRCError(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 61, true)
+	bad := binaryPacket(10)
+	good := binaryPacket(20)
+	e.InjectCorrupted(append([]byte{byte(len(bad))}, bad...))
+	e.Inject(append([]byte{byte(len(good))}, good...))
+	p, _ := r.Receive(time.Second)
+	if !bytes.Equal(p, good) {
+		t.Errorf("received % X, want % X", p, good)
+	}
+	e.InjectCorrupted(append([]byte{byte(len(bad))}, bad...))
+	p, _ = r.Receive(10 * time.Millisecond)
+	if p != nil {
+		t.Errorf("received % X from corrupted packet, want nothing", p)
+	}
+
+	// Without CRC, the corrupted packet is accepted.
+	r.SetPacketFormat(VariableLength, 61, false)
+	e.InjectCorrupted(append([]byte{byte(len(bad))}, bad...))
+	p, _ = r.Receive(time.Second)
+	if !bytes.Equal(p, bad) {
+		t.Errorf("received % X, want % X", p, bad)
+	}
+}
+
+func TestVariableLengthTooLong(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 10, false)
+	e.Inject(append([]byte{20}, binaryPacket(20)...))
+	p, _ := r.Receive(10 * time.Millisecond)
+	if p != nil {
+		t.Errorf("received % X from oversize packet, want nothing", p)
+	}
+}
+
+func TestPacketMetadata(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916600000)
+	e.SetRSSI(-75)
+	e.SetLQI(12)
+	e.SetFREQEST(-10)
+	r.Backend().WriteRegister(CHANNR, 2)
+	wantFreq := r.Frequency() + 2*103271
+	formats := []struct {
+		format PacketFormat
+		crc    bool
+		frame  func([]byte) []byte
+	}{
+		{ZeroTerminated, false, func(p []byte) []byte { return append(p, 0) }},
+		{VariableLength, true, func(p []byte) []byte { return append([]byte{byte(len(p))}, p...) }},
+		{VariableLength, false, func(p []byte) []byte { return append([]byte{byte(len(p))}, p...) }},
+	}
+	for _, f := range formats {
+		r.SetPacketFormat(f.format, 100, f.crc)
+		data := testPacket(30)
+		e.Inject(f.frame(data))
+		before := time.Now()
+		p := r.ReceivePacket(time.Second)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if !bytes.Equal(p.Data, data) {
+			t.Errorf("%v: received % X, want % X", f.format, p.Data, data)
+		}
+		if p.RSSI != -75 {
+			t.Errorf("%v: RSSI == %d, want -75", f.format, p.RSSI)
+		}
+		if p.LQI != 12 {
+			t.Errorf("%v: LQI == %d, want 12", f.format, p.LQI)
+		}
+		if p.CRCOK != f.crc {
+			t.Errorf("%v: CRCOK == %v, want %v", f.format, p.CRCOK, f.crc)
+		}
+		if p.FrequencyOffset != -14648 {
+			t.Errorf("%v: FrequencyOffset == %d, want -14648", f.format, p.FrequencyOffset)
+		}
+		if p.Channel != 2 || p.Frequency != wantFreq {
+			t.Errorf("%v: channel %d at %d Hz, want channel 2 at %d Hz", f.format, p.Channel, p.Frequency, wantFreq)
+		}
+		if p.Time.Before(before) || time.Since(p.Time) > time.Second {
+			t.Errorf("%v: Time == %v, want approximately %v", f.format, p.Time, before)
+		}
+	}
+}
+
+// interruptRecorder records the timeouts passed to AwaitInterrupt.
+type interruptRecorder struct {
+	*Emulator
+	timeouts []time.Duration
+}
+
+func (h *interruptRecorder) AwaitInterrupt(timeout time.Duration) {
+	h.timeouts = append(h.timeouts, timeout)
+	h.Emulator.AwaitInterrupt(timeout)
+}
+
+func TestReceiveAfterDeadline(t *testing.T) {
+	h := &interruptRecorder{Emulator: NewEmulator()}
+	r := OpenHardware(h)
+	r.InitRF(916600000)
+	r.SetPacketFormat(VariableLength, 61, true)
+	// The deadline passes while an invalid packet is being read.
+	data := testPacket(20)
+	h.InjectCorrupted(append([]byte{byte(len(data))}, data...))
+	r.ReceivePacket(time.Nanosecond)
+	r.SetError(nil)
+	r.ReceivePacket(-time.Second)
+	if len(h.timeouts) == 0 {
+		t.Fatal("AwaitInterrupt not called")
+	}
+	for _, d := range h.timeouts {
+		if d < 0 {
+			t.Errorf("AwaitInterrupt called with negative timeout %v", d)
+		}
+	}
+}
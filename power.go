@@ -0,0 +1,70 @@
+package cc1101
+
+import (
+	"fmt"
+)
+
+// Output power levels, in dBm, for which the data sheet
+// gives PATABLE settings (see table 39 of the data sheet).
+var paLevels = [...]int{-30, -20, -15, -10, 0, 5, 7, 10}
+
+// Optimum PATABLE settings for each output power level in paLevels,
+// by frequency band.
+var paBands = []struct {
+	maxFreq  uint32 // upper limit of frequencies using this table, in Hertz
+	settings [len(paLevels)]byte
+}{
+	{374000000, [...]byte{0x12, 0x0D, 0x1C, 0x34, 0x51, 0x85, 0xCB, 0xC2}},  // 315 MHz
+	{650000000, [...]byte{0x12, 0x0E, 0x1D, 0x34, 0x60, 0x84, 0xC8, 0xC0}},  // 433 MHz
+	{900000000, [...]byte{0x03, 0x0F, 0x1E, 0x27, 0x50, 0x81, 0xCB, 0xC2}},  // 868 MHz
+	{^uint32(0), [...]byte{0x03, 0x0E, 0x1E, 0x27, 0x8E, 0xCD, 0xC7, 0xC0}}, // 915 MHz
+}
+
+// paSetting returns the PATABLE setting for the highest output power level
+// not exceeding the given one in the band containing freq,
+// and the corresponding level in dBm.
+func paSetting(dBm int, freq uint32) (byte, int, error) {
+	if dBm < paLevels[0] {
+		return 0, 0, fmt.Errorf("output power %d dBm is below minimum (%d dBm)", dBm, paLevels[0])
+	}
+	i := len(paLevels) - 1
+	for paLevels[i] > dBm {
+		i--
+	}
+	for _, b := range paBands {
+		if freq < b.maxFreq {
+			return b.settings[i], paLevels[i], nil
+		}
+	}
+	return 0, 0, fmt.Errorf("no PATABLE settings for %d Hz", freq)
+}
+
+// SetTxPower sets the radio's output power to the highest level,
+// from those given in the data sheet, that does not exceed
+// the given power in dBm. It returns the achieved power.
+// The PATABLE setting depends on the frequency band,
+// so SetTxPower should be called after SetFrequency.
+// The setting is written to the PATABLE entry selected by FREND0.PA_POWER,
+// and lower entries are set to 0x00, so that in OOK mode
+// entry 0 is used for '0' and in the other modes the power ramps up from 0.
+func (r *Radio) SetTxPower(dBm int) int {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return 0
+	}
+	v, achieved, err := paSetting(dBm, r.frequency())
+	if err != nil {
+		r.setError(err)
+		return 0
+	}
+	f0 := r.hw.ReadRegister(FREND0)
+	if r.error() != nil {
+		return 0
+	}
+	paPower := (f0 & FREND0_PA_POWER_MASK) >> FREND0_PA_POWER_SHIFT
+	pa := make([]byte, paPower+1)
+	pa[paPower] = v
+	r.hw.WriteBurst(PATABLE, pa)
+	return achieved
+}
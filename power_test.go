@@ -0,0 +1,44 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetTxPower(t *testing.T) {
+	cases := []struct {
+		freq     uint32
+		mod      Modulation
+		dBm      int
+		achieved int
+		patable  []byte
+	}{
+		{315000000, Modulation2FSK, 10, 10, []byte{0xC2}},
+		{433920000, Modulation2FSK, 0, 0, []byte{0x60}},
+		{433920000, ModulationOOK, 6, 5, []byte{0x00, 0x84}},
+		{868300000, ModulationGFSK, -12, -15, []byte{0x1E}},
+		{868300000, ModulationOOK, 20, 10, []byte{0x00, 0xC2}},
+		{916500000, Modulation2FSK, -30, -30, []byte{0x03}},
+		{916500000, Modulation2FSK, 7, 7, []byte{0xC7}},
+	}
+	r, _ := openEmulator(t)
+	for _, c := range cases {
+		r.InitRF(c.freq)
+		r.SetModulation(c.mod, 19043)
+		achieved := r.SetTxPower(c.dBm)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if achieved != c.achieved {
+			t.Errorf("SetTxPower(%d) at %d Hz == %d, want %d", c.dBm, c.freq, achieved, c.achieved)
+		}
+		pa := r.ReadPATable()
+		if !bytes.Equal(pa[:len(c.patable)], c.patable) {
+			t.Errorf("SetTxPower(%d) at %d Hz: PATABLE == % X, want % X", c.dBm, c.freq, pa, c.patable)
+		}
+	}
+	r.SetTxPower(-31)
+	if r.Error() == nil {
+		t.Errorf("SetTxPower(-31) succeeded, want error")
+	}
+}
@@ -0,0 +1,137 @@
+package cc1101
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// Profile contains the calibration of a particular radio module,
+// which InitRF applies on top of its generated configuration.
+type Profile struct {
+	// Frequency offset written to FSCTRL0, in units of FXOSC/2^14 Hz.
+	FrequencyOffset int8 `json:"frequency_offset"`
+
+	// Error of the crystal frequency in parts per million,
+	// used to correct the crystal frequency from which
+	// the frequency registers are computed.
+	CrystalPPM float64 `json:"crystal_ppm"`
+
+	// PATABLE value used for transmitting (0 for the default).
+	PA byte `json:"pa"`
+
+	// Correction in dB added to RSSI measurements.
+	RSSIOffset int `json:"rssi_offset"`
+}
+
+// ProfileEnv is the environment variable that specifies
+// the pathname of the calibration profile file.
+const ProfileEnv = "CC1101_PROFILE"
+
+// A profile file is a JSON object mapping the device pathname
+// of each radio module to its profile.
+type profileFile map[string]Profile
+
+func readProfileFile(path string) (profileFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f profileFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f, nil
+}
+
+// LoadProfile returns the profile for the radio module with the given
+// device pathname from a profile file.
+// It reports whether the file contains a profile for the device.
+// A missing file is not an error.
+func LoadProfile(path string, device string) (Profile, bool, error) {
+	f, err := readProfileFile(path)
+	if os.IsNotExist(err) {
+		return Profile{}, false, nil
+	}
+	if err != nil {
+		return Profile{}, false, err
+	}
+	p, ok := f[device]
+	return p, ok, nil
+}
+
+// SaveProfile stores the profile for the radio module with the given
+// device pathname in a profile file, keeping the profiles of other modules.
+func SaveProfile(path string, device string, p Profile) error {
+	f, err := readProfileFile(path)
+	if os.IsNotExist(err) {
+		f, err = profileFile{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	f[device] = p
+	data, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// Profile returns the radio's calibration profile.
+func (r *Radio) Profile() Profile {
+	r.hold()
+	defer r.release()
+	return r.profile
+}
+
+// SetProfile sets the radio's calibration profile.
+// The crystal frequency is corrected immediately;
+// the other settings are applied by InitRF.
+// If the corrected crystal frequency is not supported by the radio,
+// the profile is not set and the error state is set to a RangeError.
+func (r *Radio) SetProfile(p Profile) {
+	r.hold()
+	defer r.release()
+	r.setProfile(p)
+}
+
+func (r *Radio) setProfile(p Profile) {
+	f, err := correctCrystal(r.nominalFxosc(), p.CrystalPPM)
+	if err != nil {
+		r.setError(err)
+		return
+	}
+	r.fxosc = f
+	r.profile = p
+}
+
+// nominalFxosc returns the crystal frequency without the profile's correction.
+func (r *Radio) nominalFxosc() uint32 {
+	return uncorrectCrystal(r.fxosc, r.profile.CrystalPPM)
+}
+
+// correctCrystal applies a correction in parts per million to a crystal
+// frequency, returning a RangeError if the result is not supported.
+func correctCrystal(fxosc uint32, ppm float64) (uint32, error) {
+	f := math.Round(float64(fxosc) * (1 + ppm/1e6))
+	if err := checkCrystalFrequency(f); err != nil {
+		return 0, err
+	}
+	return uint32(f), nil
+}
+
+func uncorrectCrystal(fxosc uint32, ppm float64) uint32 {
+	return uint32(math.Round(float64(fxosc) / (1 + ppm/1e6)))
+}
+
+// applyProfile writes the profile's register settings
+// after InitRF has configured the radio.
+func (r *Radio) applyProfile() {
+	r.hw.WriteRegister(FSCTRL0, byte(r.profile.FrequencyOffset))
+	if r.profile.PA != 0 {
+		r.hw.WriteBurst(PATABLE, []byte{0x00, r.profile.PA})
+	}
+}
@@ -0,0 +1,124 @@
+package cc1101
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cc1101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "profile.json")
+	if _, ok, err := LoadProfile(path, "/dev/spidev0.0"); ok || err != nil {
+		t.Errorf("loading missing file: %v, %v", ok, err)
+	}
+	p0 := Profile{FrequencyOffset: -12, CrystalPPM: 17.5, PA: 0x84, RSSIOffset: 3}
+	p1 := Profile{FrequencyOffset: 4, CrystalPPM: -8.25}
+	if err := SaveProfile(path, "/dev/spidev0.0", p0); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveProfile(path, "/dev/spidev1.0", p1); err != nil {
+		t.Fatal(err)
+	}
+	for dev, want := range map[string]Profile{"/dev/spidev0.0": p0, "/dev/spidev1.0": p1} {
+		p, ok, err := LoadProfile(path, dev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || p != want {
+			t.Errorf("LoadProfile(%s) == %+v, %v, want %+v", dev, p, ok, want)
+		}
+	}
+	if _, ok, err := LoadProfile(path, "/dev/spidev2.0"); ok || err != nil {
+		t.Errorf("loading unknown device: %v, %v", ok, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadProfile(path, "/dev/spidev0.0"); err == nil {
+		t.Errorf("loading invalid file succeeded")
+	}
+	if err := SaveProfile(path, "/dev/spidev0.0", p0); err == nil {
+		t.Errorf("saving to invalid file succeeded")
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	const freq = 916600000
+	r, e := openEmulator(t)
+	r.InitRF(freq)
+	base := e.Configuration()
+	p := Profile{FrequencyOffset: -9, CrystalPPM: 20, PA: 0x84, RSSIOffset: -4}
+	r.SetProfile(p)
+	if r.Profile() != p {
+		t.Errorf("Profile() == %+v, want %+v", r.Profile(), p)
+	}
+	if fxosc := r.CrystalFrequency(); fxosc != FXOSC+480 {
+		t.Errorf("crystal frequency == %d, want %d", fxosc, FXOSC+480)
+	}
+	r.InitRF(freq)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	c := e.Configuration()
+	if int8(c.FSCTRL0) != p.FrequencyOffset {
+		t.Errorf("FSCTRL0 == %d, want %d", int8(c.FSCTRL0), p.FrequencyOffset)
+	}
+	// A faster crystal needs a smaller frequency word.
+	word := func(c RFConfiguration) uint32 {
+		return uint32(c.FREQ2)<<16 | uint32(c.FREQ1)<<8 | uint32(c.FREQ0)
+	}
+	if word(c) >= word(base) {
+		t.Errorf("FREQ == %06X, want less than %06X", word(c), word(base))
+	}
+	if f := r.Frequency(); f < freq-400 || f > freq+400 {
+		t.Errorf("frequency == %d, want %d", f, freq)
+	}
+	if pa := r.hw.ReadBurst(PATABLE, 2); !bytes.Equal(pa, []byte{0x00, p.PA}) {
+		t.Errorf("PATABLE == % X, want 00 %02X", pa, p.PA)
+	}
+	e.SetRSSI(-60)
+	if rssi := r.ReadRSSI(); rssi != -64 {
+		t.Errorf("ReadRSSI() == %d, want -64", rssi)
+	}
+	e.Inject(append(testPacket(10), 0))
+	if pkt := r.ReceivePacket(time.Second); pkt.Data == nil || pkt.RSSI != -64 {
+		t.Errorf("received packet %v with RSSI %d, want -64", pkt.Data, pkt.RSSI)
+	}
+	// Changing the crystal frequency keeps the correction.
+	r.SetCrystalFrequency(26000000)
+	if fxosc := r.CrystalFrequency(); fxosc != 26000520 {
+		t.Errorf("crystal frequency == %d, want 26000520", fxosc)
+	}
+	r.SetProfile(Profile{})
+	if fxosc := r.CrystalFrequency(); fxosc != 26000000 {
+		t.Errorf("crystal frequency == %d after clearing profile, want 26000000", fxosc)
+	}
+	// A correction giving an unsupported crystal frequency is rejected.
+	for _, ppm := range []float64{-1e6, 2e5, 1e300, math.NaN()} {
+		r.SetProfile(Profile{CrystalPPM: ppm})
+		if _, ok := r.Error().(RangeError); !ok {
+			t.Errorf("SetProfile with %g ppm: error == %v, want RangeError", ppm, r.Error())
+		}
+		r.SetError(nil)
+		if fxosc := r.CrystalFrequency(); fxosc != 26000000 {
+			t.Errorf("SetProfile with %g ppm changed crystal frequency to %d", ppm, fxosc)
+		}
+	}
+	r.SetCrystalFrequency(FXOSC)
+	r.InitRF(freq)
+	if c := e.Configuration(); c != base {
+		t.Errorf("configuration after clearing profile differs from default")
+	}
+	if pa := r.hw.ReadBurst(PATABLE, 2); !bytes.Equal(pa, []byte{0x00, 0xC0}) {
+		t.Errorf("PATABLE == % X, want default", pa)
+	}
+}
@@ -2,10 +2,39 @@ package cc1101
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 )
 
+var (
+	// ErrPacketTooLarge indicates an attempt to send a packet
+	// that is larger than the current packet format allows.
+	ErrPacketTooLarge = errors.New("packet too large")
+
+	// ErrUnexpectedState indicates that the radio was found
+	// in an unexpected state. The error returned by Error
+	// is a StateError, which matches it with errors.Is.
+	ErrUnexpectedState = errors.New("unexpected radio state")
+)
+
+// StateError indicates that the radio was found in an unexpected state
+// during the given operation.
+type StateError struct {
+	State byte
+	Op    string
+}
+
+func (e StateError) Error() string {
+	return fmt.Sprintf("unexpected %s state while %s", StateName(e.State), e.Op)
+}
+
+// Is reports whether target is ErrUnexpectedState.
+func (e StateError) Is(target error) bool {
+	return target == ErrUnexpectedState
+}
+
 const (
 	verbose            = false
 	maxPacketSize      = 110
@@ -14,6 +43,16 @@ const (
 
 	// Approximate time for one byte to be transmitted, based on the data rate.
 	byteDuration = time.Millisecond
+
+	// TX FIFO threshold used while refilling the TXFIFO.
+	// FIFO_THR = 7 corresponds to 33 bytes (see table 44 of the data sheet),
+	// so about half the TXFIFO can be refilled at a time,
+	// with the other half still to be sent.
+	txFIFOThreshold = 7
+
+	// GDO configuration asserted when the TXFIFO is filled at or above
+	// the TX FIFO threshold, de-asserted when it drains below it.
+	gdoTXFIFOThreshold = 0x02
 )
 
 func init() {
@@ -23,92 +62,230 @@ func init() {
 }
 
 // Send transmits the given packet.
+// If address filtering is enabled, it is sent to BroadcastAddress.
 func (r *Radio) Send(data []byte) {
-	if len(data) > maxPacketSize {
-		log.Panicf("attempting to send %d-byte packet", len(data))
-	}
-	if r.Error() != nil {
+	r.holdLong()
+	defer r.release()
+	r.sendTo(BroadcastAddress, data)
+}
+
+// SendTo transmits the given packet to the given destination address.
+// The address is ignored unless address filtering is enabled.
+func (r *Radio) SendTo(addr byte, data []byte) {
+	r.holdLong()
+	defer r.release()
+	r.sendTo(addr, data)
+}
+
+func (r *Radio) sendTo(addr byte, data []byte) {
+	if r.error() != nil || !r.checkSize(data) {
 		return
 	}
 	if verbose {
-		log.Printf("sending %d-byte packet in %s state", len(data), r.State())
+		log.Printf("sending %d-byte packet in %s state", len(data), r.state())
 	}
-	// Terminate packet with zero byte,
-	// and pad with another to ensure final bytes
-	// are transmitted before leaving TX state.
-	packet := make([]byte, len(data)+2)
-	copy(packet, data)
-	defer r.changeState(SIDLE, STATE_IDLE)
+	packet := r.frame(addr, data)
 	r.transmit(packet)
+	r.idleAfterTX()
+}
+
+// checkSize sets the error state to ErrPacketTooLarge
+// if the given payload is too large for the current packet format,
+// and reports whether it can be sent.
+func (r *Radio) checkSize(data []byte) bool {
+	if len(data) <= r.maxPayload() {
+		return true
+	}
+	r.setError(fmt.Errorf("%w: %d-byte %v packet (maximum %d)", ErrPacketTooLarge, len(data), r.packetFormat, r.maxPayload()))
+	return false
+}
+
+// idleAfterTX returns the radio to IDLE state after sending a packet,
+// without clearing the error state.
+func (r *Radio) idleAfterTX() {
+	err := r.error()
+	r.changeState(SIDLE, STATE_IDLE)
+	if err != nil {
+		r.setError(err)
+	}
 }
 
 func (r *Radio) transmit(data []byte) {
-	avail := fifoSize
-	for r.Error() == nil {
+	n := r.fillTXFIFO(data)
+	r.changeState(STX, STATE_TX)
+	r.continueTX(data[n:], n)
+}
+
+// fillTXFIFO writes as much of the given data as will fit
+// into the empty TXFIFO, and returns the number of bytes written.
+func (r *Radio) fillTXFIFO(data []byte) int {
+	if r.packetFormat == ExtendedLength {
+		r.setLength(len(data))
+	}
+	n := len(data)
+	if n > fifoSize {
+		n = fifoSize
+	}
+	r.hw.WriteBurst(TXFIFO, data[:n])
+	return n
+}
+
+// continueTX completes a transmission that was started
+// after writing avail bytes to the TXFIFO,
+// writing the remaining data as space becomes available.
+func (r *Radio) continueTX(data []byte, avail int) {
+	bt := r.byteTime()
+	if len(data) != 0 {
+		avail = r.refillTXFIFO(data, bt)
+	}
+	r.finishTX(avail, bt)
+}
+
+// refillTXFIFO writes the remaining data of a packet that is larger
+// than the TXFIFO, each time the TXFIFO drains below the TX FIFO threshold.
+// See TI Design Note DN500 (swra109c).
+// It returns the number of bytes in the TXFIFO after the last write.
+func (r *Radio) refillTXFIFO(data []byte, bt time.Duration) int {
+	iocfg0 := r.hw.ReadRegister(IOCFG0)
+	fifothr := r.hw.ReadRegister(FIFOTHR)
+	r.hw.WriteRegister(FIFOTHR, fifothr&^FIFOTHR_MASK|txFIFOThreshold)
+	// Invert the GDO0 output so that the (rising-edge) interrupt
+	// occurs when there is room in the TXFIFO for the next write.
+	r.hw.WriteRegister(IOCFG0, GDO0_INV|gdoTXFIFOThreshold)
+	threshold := txThresholdBytes(txFIFOThreshold)
+	level := 0
+	for r.error() == nil {
+		n := int(r.readNumTXBytes())
+		if r.error() != nil {
+			break
+		}
+		avail := fifoSize - n
 		if avail > len(data) {
 			avail = len(data)
 		}
-		r.hw.WriteBurst(TXFIFO, data[:avail])
-		r.changeState(STX, STATE_TX)
-		data = data[avail:]
+		if avail > 0 {
+			r.hw.WriteBurst(TXFIFO, data[:avail])
+			data = data[avail:]
+		}
+		level = n + avail
+		r.switchLength(len(data) + level)
 		if len(data) == 0 {
 			break
 		}
-		// Transmitting a packet that is larger than the TXFIFO size.
-		// See TI Design Note DN500 (swra109c).
-		// Err on the short side here to avoid TXFIFO underflow.
-		time.Sleep(fifoSize / 4 * byteDuration)
-		for r.Error() == nil {
-			n := r.ReadNumTXBytes()
-			if n < fifoSize {
-				avail = fifoSize - int(n)
-				if avail > len(data) {
-					avail = len(data)
-				}
-				break
-			}
+		// If the interrupt is missed, time out when the TXFIFO
+		// should have drained to the threshold.
+		r.hw.AwaitInterrupt(time.Duration(level-threshold+1) * bt)
+		if isInterruptTimeout(r.error()) {
+			r.setError(nil)
 		}
 	}
-	r.finishTX(avail)
+	err := r.error()
+	r.hw.WriteRegister(IOCFG0, iocfg0)
+	r.hw.WriteRegister(FIFOTHR, fifothr)
+	if err != nil {
+		r.setError(err)
+	}
+	return level
+}
+
+// txThresholdBytes returns the TX FIFO threshold in bytes
+// for the given FIFOTHR value.
+func txThresholdBytes(fifothr byte) int {
+	return 61 - 4*int(fifothr&FIFOTHR_MASK)
 }
 
-func (r *Radio) finishTX(numBytes int) {
-	time.Sleep(time.Duration(numBytes) * byteDuration)
-	for r.Error() == nil {
-		n := r.ReadNumTXBytes()
-		if n == 0 || r.Error() == ErrTXFIFOUnderflow {
+// byteTime returns the time to send one byte at the configured data rate.
+// Manchester encoding and FEC make it longer, so timing based on it
+// errs on the short side.
+func (r *Radio) byteTime() time.Duration {
+	_, drate := r.readChannelParams()
+	if r.error() != nil || drate == 0 {
+		return byteDuration
+	}
+	return 8 * time.Second / time.Duration(drate)
+}
+
+func (r *Radio) finishTX(numBytes int, bt time.Duration) {
+	time.Sleep(time.Duration(numBytes) * bt)
+	for r.error() == nil {
+		n := r.readNumTXBytes()
+		if n == 0 || r.error() == ErrTXFIFOUnderflow {
+			break
+		}
+		s := r.readState()
+		if s != STATE_TX && s != STATE_TXFIFO_UNDERFLOW && r.leavesTX() {
+			// The packet was completed since TXBYTES was read.
 			break
 		}
-		s := r.ReadState()
 		if s != STATE_TX && s != STATE_TXFIFO_UNDERFLOW {
-			log.Panicf("unexpected %s state while finishing TX", StateName(s))
+			r.setError(StateError{State: s, Op: "finishing TX"})
+			break
 		}
 		if verbose {
 			log.Printf("waiting to transmit %d bytes in %s state", n, StateName(s))
 		}
-		time.Sleep(byteDuration)
+		time.Sleep(bt)
+	}
+	if r.error() == ErrTXFIFOUnderflow && !r.leavesTX() {
+		// A ZeroTerminated packet ends with a TXFIFO underflow.
+		r.setError(nil)
+	}
+	// In fixed- and variable-length modes, the radio leaves TX state
+	// by itself after sending the CRC, if any.
+	for r.leavesTX() && r.error() == nil && r.readState() == STATE_TX {
+		time.Sleep(bt)
+	}
+	if r.packetFormat == ExtendedLength {
+		r.resetLength()
 	}
 	if verbose {
-		log.Printf("TX finished in %s state", r.State())
+		log.Printf("TX finished in %s state", r.state())
 	}
 }
 
+// leavesTX reports whether the radio leaves TX state by itself
+// at the end of the packet being sent, rather than on TXFIFO underflow.
+func (r *Radio) leavesTX() bool {
+	return r.packetFormat != ZeroTerminated || r.fixedTX
+}
+
 // Receive listens with the given timeout for an incoming packet.
 // It returns the packet and the associated RSSI.
 func (r *Radio) Receive(timeout time.Duration) ([]byte, int) {
-	if r.Error() != nil {
-		return nil, 0
+	r.holdLong()
+	defer r.release()
+	p := r.receivePacket(timeout, false)
+	return p.Data, p.RSSI
+}
+
+// ReceivePacket listens with the given timeout for an incoming packet.
+// It returns the packet and its metadata.
+// The packet's Data field is nil if no packet was received.
+func (r *Radio) ReceivePacket(timeout time.Duration) Packet {
+	r.holdLong()
+	defer r.release()
+	return r.receivePacket(timeout, false)
+}
+
+// receivePacket listens with the given timeout for an incoming packet,
+// in RX state or in Wake-on-Radio mode if wor is true.
+func (r *Radio) receivePacket(timeout time.Duration, wor bool) Packet {
+	if r.error() != nil {
+		return Packet{}
 	}
-	r.changeState(SRX, STATE_RX)
+	if r.packetFormat != ZeroTerminated {
+		return r.receiveFramed(timeout, wor)
+	}
+	r.listen(wor)
 	defer r.changeState(SIDLE, STATE_IDLE)
 	if verbose {
-		log.Printf("waiting for interrupt in %s state", r.State())
+		log.Printf("waiting for interrupt in %s state", r.state())
 	}
 	r.hw.AwaitInterrupt(timeout)
-	rssi := r.ReadRSSI()
-	for r.Error() == nil {
-		numBytes := r.ReadNumRXBytes()
-		if r.Error() == ErrRXFIFOOverflow {
+	p := Packet{Time: time.Now(), RSSI: r.readRSSI()}
+	for r.error() == nil {
+		numBytes := r.readNumRXBytes()
+		if r.error() == ErrRXFIFOOverflow {
 			// Flush RX FIFO and change back to RX.
 			r.changeState(SRX, STATE_RX)
 			continue
@@ -127,9 +304,9 @@ func (r *Radio) Receive(timeout time.Duration) ([]byte, int) {
 			continue
 		}
 		// End of packet.
-		return r.finishRX(rssi)
+		return r.finishRX(p)
 	}
-	return nil, rssi
+	return Packet{RSSI: p.RSSI}
 }
 
 // readFIFO reads data from the RXFIFO into the receive buffer.
@@ -138,7 +315,7 @@ func (r *Radio) Receive(timeout time.Duration) ([]byte, int) {
 func (r *Radio) readFIFO(n int) bool {
 	if readFIFOUsingBurst {
 		data := r.hw.ReadBurst(RXFIFO, n)
-		if r.Error() != nil {
+		if r.error() != nil {
 			return false
 		}
 		i := bytes.IndexByte(data, 0)
@@ -151,7 +328,7 @@ func (r *Radio) readFIFO(n int) bool {
 		_, r.err = r.receiveBuffer.Write(data[:i])
 	} else {
 		c := r.hw.ReadRegister(RXFIFO)
-		if r.Error() != nil {
+		if r.error() != nil {
 			return false
 		}
 		if c != 0 {
@@ -162,33 +339,96 @@ func (r *Radio) readFIFO(n int) bool {
 	return true
 }
 
-func (r *Radio) finishRX(rssi int) ([]byte, int) {
+func (r *Radio) finishRX(p Packet) Packet {
+	// Status bytes cannot be appended in infinite-length mode,
+	// so read the link quality from the status register.
+	lqi := r.hw.ReadRegister(LQI)
+	p.LQI = lqi & LQI_LQI_EST_MASK
+	r.readPacketInfo(&p)
 	r.changeState(SIDLE, STATE_IDLE)
-	r.Strobe(SFRX)
+	r.strobe(SFRX)
 	size := r.receiveBuffer.Len()
 	if size == 0 {
-		return nil, rssi
+		return Packet{RSSI: p.RSSI}
 	}
-	p := make([]byte, size)
-	_, err := r.receiveBuffer.Read(p)
-	r.SetError(err)
-	if r.Error() != nil {
-		return nil, rssi
+	p.Data = make([]byte, size)
+	_, err := r.receiveBuffer.Read(p.Data)
+	r.setError(err)
+	if r.error() != nil {
+		return Packet{RSSI: p.RSSI}
 	}
 	r.receiveBuffer.Reset()
 	if verbose {
-		log.Printf("received %d-byte packet in %s state; %d bytes remaining", size, r.State(), r.ReadNumRXBytes())
+		log.Printf("received %d-byte packet in %s state; %d bytes remaining", size, r.state(), r.readNumRXBytes())
 	}
-	return p, rssi
+	r.trackFrequency()
+	return p
 }
 
 // SendAndReceive transmits the given packet,
 // then listens with the given timeout for an incoming packet.
 // It returns the packet and the associated RSSI.
+//
+// The radio goes directly from TX to RX state when the packet has been
+// sent (MCSM1.TXOFF_MODE = RX), without passing through IDLE state,
+// so the synthesizer is only calibrated before transmitting
+// (MCSM0.FS_AUTOCAL = FROM_IDLE), or not at all when using
+// CalibrateChannels, and a fast response is not missed.
+// Since the radio cannot leave TX state by itself in infinite-length mode,
+// ZeroTerminated packets are sent as if their length were known
+// (see ExtendedLength).
+// The timeout starts when the packet has been sent.
 func (r *Radio) SendAndReceive(data []byte, timeout time.Duration) ([]byte, int) {
-	r.Send(data)
-	if r.Error() != nil {
+	r.holdLong()
+	defer r.release()
+	if r.error() != nil || !r.checkSize(data) {
+		return nil, 0
+	}
+	packet := r.frame(BroadcastAddress, data)
+	mcsm := r.hw.ReadBurst(MCSM1, 2)
+	if r.error() != nil {
+		return nil, 0
+	}
+	r.changeState(SIDLE, STATE_IDLE)
+	mcsm0 := mcsm[1]
+	if r.fscal == nil {
+		mcsm0 = mcsm0&^MCSM0_FS_AUTOCAL_TO_IDLE_EVERY_4 | MCSM0_FS_AUTOCAL_FROM_IDLE
+	}
+	r.hw.WriteBurst(MCSM1, []byte{mcsm[0]&^0x3 | MCSM1_TXOFF_MODE_RX, mcsm0})
+	r.transmitThenRX(packet)
+	p := Packet{}
+	if r.error() == nil {
+		p = r.receivePacket(timeout, false)
+	}
+	err := r.error()
+	r.changeState(SIDLE, STATE_IDLE)
+	r.hw.WriteBurst(MCSM1, mcsm)
+	if err != nil {
+		r.setError(err)
 		return nil, 0
 	}
-	return r.Receive(timeout)
+	return p.Data, p.RSSI
+}
+
+// transmitThenRX sends the given frame with MCSM1.TXOFF_MODE = RX,
+// leaving the radio in RX state.
+func (r *Radio) transmitThenRX(packet []byte) {
+	if r.packetFormat != ZeroTerminated {
+		r.transmit(packet)
+		return
+	}
+	pktlen := r.hw.ReadRegister(PKTLEN)
+	r.setLength(len(packet))
+	r.fixedTX = true
+	r.transmit(packet)
+	r.fixedTX = false
+	// Restore infinite-length mode while the preamble
+	// of the response (if any) is being received.
+	err := r.error()
+	r.setError(nil)
+	r.resetLength()
+	r.hw.WriteRegister(PKTLEN, pktlen)
+	if err != nil {
+		r.setError(err)
+	}
 }
@@ -0,0 +1,190 @@
+package cc1101
+
+import (
+	"context"
+	"time"
+
+	"github.com/ecc1/gpio"
+)
+
+// HardwareError wraps an error reported by the radio hardware.
+type HardwareError struct {
+	Err error
+}
+
+func (e HardwareError) Error() string {
+	return "radio hardware: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e HardwareError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// Interval at which ReceiveContext checks for cancellation
+	// while waiting for an interrupt.
+	interruptPollTime = 10 * time.Millisecond
+
+	// Minimum time allowed to receive the rest of a packet
+	// once its sync word has been seen.
+	minPacketTime = (255 + 1 + numStatusBytes) * byteDuration
+)
+
+// maxPacketTime returns the maximum time to receive the rest of a packet
+// once its sync word has been seen. It allows twice the time to send the
+// largest frame in the current packet format, since Manchester encoding
+// or FEC may double the time per byte, but no less than minPacketTime.
+func (r *Radio) maxPacketTime() time.Duration {
+	n := r.frameSize(r.packetLength) + numStatusBytes
+	d := 2 * time.Duration(n) * r.byteTime()
+	if d < minPacketTime {
+		return minPacketTime
+	}
+	return d
+}
+
+// transient reports whether err is the outcome of an earlier operation
+// that leaves the radio usable, rather than a hardware failure.
+func transient(err error) bool {
+	switch err {
+	case ErrChannelBusy, ErrPacketTooLarge, ErrRXFIFOOverflow, ErrTXFIFOUnderflow:
+		return true
+	}
+	return isInterruptTimeout(err)
+}
+
+// isInterruptTimeout reports whether err indicates
+// that AwaitInterrupt timed out.
+func isInterruptTimeout(err error) bool {
+	_, ok := err.(gpio.TimeoutError)
+	return ok || err == ErrInterruptTimeout
+}
+
+// ReceiveContext listens for an incoming packet until one is received
+// or the context is done. It returns the packet and its metadata,
+// or one of the following errors:
+//   - ctx.Err(), if the context was cancelled or its deadline passed
+//     before a packet arrived;
+//   - ErrRXFIFOOverflow, if the RXFIFO overflowed and data was lost;
+//   - a HardwareError, if the radio hardware failed, including when
+//     an earlier call left an error state that is not transient
+//     (ErrChannelBusy, ErrPacketTooLarge, a FIFO error, or a timeout).
+//
+// A packet that is already being received when the context is done
+// is read and returned. In all cases, the radio is left in IDLE state
+// with the RXFIFO flushed.
+func (r *Radio) ReceiveContext(ctx context.Context) (Packet, error) {
+	r.holdLong()
+	defer r.release()
+	if err := ctx.Err(); err != nil {
+		return Packet{}, err
+	}
+	// An error left by an earlier call, such as ErrChannelBusy,
+	// does not prevent receiving, but any other error does.
+	if err := r.error(); err != nil {
+		if !transient(err) {
+			return Packet{}, HardwareError{err}
+		}
+		r.setError(nil)
+	}
+	defer r.stopRX()
+	r.changeState(SRX, STATE_RX)
+	for r.error() == nil {
+		r.hw.AwaitInterrupt(interruptPollTime)
+		if err := r.error(); err != nil {
+			if !isInterruptTimeout(err) {
+				break
+			}
+			r.setError(nil)
+			if ctx.Err() == nil {
+				continue
+			}
+			// Don't lose a packet that is already arriving.
+			if !r.receiving() {
+				if r.error() != nil {
+					break
+				}
+				return Packet{}, ctx.Err()
+			}
+		}
+		t := time.Now()
+		p, ok := r.readAnyPacket(t.Add(r.maxPacketTime()))
+		if r.error() != nil {
+			break
+		}
+		if ok {
+			p.Time = t
+			r.stopRX()
+			r.trackFrequency()
+			return p, nil
+		}
+		// Discard the invalid packet and listen again.
+		r.stopRX()
+		if ctx.Err() != nil {
+			return Packet{}, ctx.Err()
+		}
+		r.changeState(SRX, STATE_RX)
+	}
+	if r.error() == ErrRXFIFOOverflow {
+		return Packet{}, ErrRXFIFOOverflow
+	}
+	return Packet{}, HardwareError{r.error()}
+}
+
+// receiving reports whether a packet is being received.
+func (r *Radio) receiving() bool {
+	if r.hw.ReadInterrupt() {
+		return true
+	}
+	return r.error() == nil && r.readNumRXBytes() != 0
+}
+
+// readAnyPacket reads a packet in the current packet format
+// from the RXFIFO, waiting until the given deadline for it to be received.
+// It returns the packet and whether it is valid.
+func (r *Radio) readAnyPacket(deadline time.Time) (Packet, bool) {
+	if r.packetFormat == ZeroTerminated {
+		return r.readZeroTerminated(deadline)
+	}
+	p, ok := r.readPacket(deadline)
+	if ok {
+		r.readPacketInfo(&p)
+	}
+	return p, ok
+}
+
+// readZeroTerminated reads a zero-terminated packet from the RXFIFO,
+// waiting until the given deadline for it to be received.
+// It returns the packet and whether it is valid.
+func (r *Radio) readZeroTerminated(deadline time.Time) (Packet, bool) {
+	p := Packet{RSSI: r.readRSSI()}
+	r.receiveBuffer.Reset()
+	for r.error() == nil {
+		numBytes := r.readNumRXBytes()
+		if r.error() != nil {
+			break
+		}
+		// Don't read last byte of FIFO if packet is still
+		// being received. See Section 20 of data sheet.
+		if numBytes < 2 {
+			if time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(byteDuration)
+			continue
+		}
+		if r.readFIFO(int(numBytes)) {
+			p = r.finishRX(p)
+			return p, p.Data != nil
+		}
+	}
+	r.receiveBuffer.Reset()
+	return Packet{}, false
+}
+
+// stopRX returns the radio to IDLE state and flushes the RXFIFO.
+func (r *Radio) stopRX() {
+	r.changeState(SIDLE, STATE_IDLE)
+	r.strobe(SFRX)
+}
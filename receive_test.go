@@ -0,0 +1,133 @@
+package cc1101
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReceiveContext(t *testing.T) {
+	for _, format := range []PacketFormat{ZeroTerminated, VariableLength} {
+		r, e := openEmulator(t)
+		r.InitRF(868300000)
+		data := testPacket(50)
+		packet := append(data, 0)
+		if format == VariableLength {
+			r.SetPacketFormat(format, 61, true)
+			packet = append([]byte{byte(len(data))}, data...)
+		}
+		e.Inject(packet)
+		p, err := r.ReceiveContext(context.Background())
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		if !bytes.Equal(p.Data, data) {
+			t.Errorf("%v: received % X, want % X", format, p.Data, data)
+		}
+	}
+}
+
+func TestReceiveContextTimeout(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := r.ReceiveContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("ReceiveContext error == %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 30*time.Millisecond+5*interruptPollTime {
+		t.Errorf("ReceiveContext returned after %v", d)
+	}
+	if e.State() != STATE_IDLE || r.ReadNumRXBytes() != 0 {
+		t.Errorf("state, RXBYTES after timeout == %s, %d, want IDLE, 0", StateName(e.State()), r.ReadNumRXBytes())
+	}
+	if r.Error() != nil {
+		t.Errorf("error state after timeout == %v", r.Error())
+	}
+
+	// A context that is already done returns immediately.
+	_, err = r.ReceiveContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("ReceiveContext error == %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// missedInterrupt simulates a context being cancelled
+// just as a packet starts arriving, before its interrupt is seen.
+type missedInterrupt struct {
+	*Emulator
+	cancel context.CancelFunc
+}
+
+func (h missedInterrupt) AwaitInterrupt(timeout time.Duration) {
+	h.Emulator.AwaitInterrupt(timeout)
+	if h.Error() == nil {
+		h.cancel()
+		h.SetError(ErrInterruptTimeout)
+	}
+}
+
+func TestReceiveContextInFlight(t *testing.T) {
+	e := NewEmulator()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := OpenHardware(missedInterrupt{e, cancel})
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 255, true)
+	data := binaryPacket(200)
+	e.Inject(append([]byte{byte(len(data))}, data...))
+	p, err := r.ReceiveContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Data, data) {
+		t.Errorf("received % X, want % X", p.Data, data)
+	}
+	if ctx.Err() == nil {
+		t.Errorf("context was not cancelled")
+	}
+}
+
+func TestReceiveContextErrors(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 61, false)
+	e.InjectOverflow()
+	_, err := r.ReceiveContext(context.Background())
+	if err != ErrRXFIFOOverflow {
+		t.Errorf("ReceiveContext error == %v, want %v", err, ErrRXFIFOOverflow)
+	}
+	if e.State() != STATE_IDLE || r.ReadNumRXBytes() != 0 {
+		t.Errorf("state, RXBYTES after overflow == %s, %d, want IDLE, 0", StateName(e.State()), r.ReadNumRXBytes())
+	}
+
+	// Errors left by earlier calls are not reported as hardware errors.
+	for _, prev := range []error{ErrChannelBusy, ErrPacketTooLarge} {
+		r.SetError(prev)
+		data := testPacket(10)
+		e.Inject(append([]byte{byte(len(data))}, data...))
+		p, err := r.ReceiveContext(context.Background())
+		if err != nil || !bytes.Equal(p.Data, data) {
+			t.Errorf("ReceiveContext after %v == %d bytes, %v, want %d bytes", prev, len(p.Data), err, len(data))
+		}
+	}
+
+	// Other errors, such as a failure to wake up, prevent receiving.
+	r.SetError(ErrNotReady)
+	_, err = r.ReceiveContext(context.Background())
+	if hwErr := (HardwareError{}); !errors.As(err, &hwErr) || hwErr.Err != ErrNotReady {
+		t.Errorf("ReceiveContext error == %v, want HardwareError(%v)", err, ErrNotReady)
+	}
+	r.SetError(nil)
+
+	e.Close()
+	_, err = r.ReceiveContext(context.Background())
+	var hwErr HardwareError
+	if !errors.As(err, &hwErr) || !errors.Is(err, ErrEmulatorClosed) {
+		t.Errorf("ReceiveContext error == %v, want HardwareError(%v)", err, ErrEmulatorClosed)
+	}
+}
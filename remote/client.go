@@ -0,0 +1,315 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ecc1/cc1101"
+	"github.com/ecc1/radio"
+)
+
+var (
+	// ErrReceiveTimeout indicates that no packet was received
+	// before the timeout expired.
+	ErrReceiveTimeout = errors.New("timeout waiting for packet")
+
+	// ErrClosed indicates that the connection to the server was closed.
+	ErrClosed = errors.New("connection to server closed")
+
+	// ErrBadResponse indicates a response from the server
+	// that is missing the requested information.
+	ErrBadResponse = errors.New("malformed response from server")
+)
+
+// ServerError is an error reported by the server.
+type ServerError string
+
+func (e ServerError) Error() string {
+	return "cc1101d: " + string(e)
+}
+
+// Radio is a client of a Server.
+// It implements radio.Interface, so it can be used
+// in place of a cc1101.Radio that is opened directly.
+type Radio struct {
+	conn      net.Conn
+	enc       *json.Encoder
+	responses chan response
+	packets   chan cc1101.Packet
+
+	mu         sync.Mutex // serializes requests
+	nextID     uint64
+	subscribed bool
+	err        error
+}
+
+var _ radio.Interface = (*Radio)(nil)
+
+// Open connects to the server's socket, given by the
+// CC1101D_SOCKET environment variable or DefaultSocket.
+func Open() *Radio {
+	path := os.Getenv("CC1101D_SOCKET")
+	if path == "" {
+		path = DefaultSocket
+	}
+	return Dial(path)
+}
+
+// Dial connects to the server listening on the given socket.
+func Dial(path string) *Radio {
+	r := &Radio{
+		responses: make(chan response),
+		packets:   make(chan cc1101.Packet, packetQueueSize),
+	}
+	r.conn, r.err = net.Dial("unix", path)
+	if r.err != nil {
+		return r
+	}
+	r.enc = json.NewEncoder(r.conn)
+	go r.read()
+	return r
+}
+
+// read dispatches messages from the server until the connection is closed.
+func (r *Radio) read() {
+	defer close(r.responses)
+	dec := json.NewDecoder(bufio.NewReader(r.conn))
+	for {
+		var resp response
+		if dec.Decode(&resp) != nil {
+			return
+		}
+		if resp.ID != 0 {
+			r.responses <- resp
+			continue
+		}
+		if resp.Packet == nil {
+			continue
+		}
+		select {
+		case r.packets <- *resp.Packet:
+		default:
+			// Discard the oldest packet to make room.
+			select {
+			case <-r.packets:
+			default:
+			}
+			r.packets <- *resp.Packet
+		}
+	}
+}
+
+// clearTimeout discards a receive timeout left by the previous request.
+// Timeouts are an expected outcome of Receive, so unlike other errors,
+// which remain set until SetError(nil) is called, a timeout is reported
+// by Error only until the next request, which it does not prevent.
+// It must be called with r.mu held.
+func (r *Radio) clearTimeout() {
+	if r.err == ErrReceiveTimeout {
+		r.err = nil
+	}
+}
+
+// call sends a request to the server and waits for its response.
+// It must be called with r.mu held.
+func (r *Radio) call(req request) response {
+	r.clearTimeout()
+	if r.err != nil {
+		return response{}
+	}
+	r.nextID++
+	req.ID = r.nextID
+	r.err = r.enc.Encode(req)
+	if r.err != nil {
+		return response{}
+	}
+	resp, ok := <-r.responses
+	if !ok {
+		r.err = ErrClosed
+		return response{}
+	}
+	if resp.Error != "" {
+		r.err = ServerError(resp.Error)
+	} else if resp.Timeout {
+		r.err = ErrReceiveTimeout
+	}
+	return resp
+}
+
+func (r *Radio) do(req request) response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.call(req)
+}
+
+// Init initializes the server's radio.
+// This affects all of the server's clients.
+func (r *Radio) Init(frequency uint32) {
+	r.do(request{Op: opInit, Frequency: frequency})
+}
+
+// Reset resets the server's radio.
+// This affects all of the server's clients.
+func (r *Radio) Reset() {
+	r.do(request{Op: opReset})
+}
+
+// Close closes the connection to the server.
+// The server's radio remains open.
+func (r *Radio) Close() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+}
+
+// Frequency returns the radio's frequency, in Hertz.
+func (r *Radio) Frequency() uint32 {
+	return r.do(request{Op: opFrequency}).Frequency
+}
+
+// SetFrequency sets the radio's frequency, in Hertz.
+func (r *Radio) SetFrequency(freq uint32) {
+	r.do(request{Op: opSetFrequency, Frequency: freq})
+}
+
+// Send transmits the given packet.
+func (r *Radio) Send(data []byte) {
+	r.do(request{Op: opSend, Data: data})
+}
+
+// Subscribe asks the server to deliver received packets to this client.
+// Receive and ReceivePacket subscribe automatically, but packets received
+// by the server before the first call are not delivered unless
+// Subscribe has already been called.
+func (r *Radio) Subscribe() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribe()
+}
+
+func (r *Radio) subscribe() {
+	if r.subscribed {
+		return
+	}
+	r.call(request{Op: opSubscribe})
+	r.subscribed = r.err == nil
+}
+
+// Unsubscribe stops the delivery of received packets to this client
+// and discards any that have not been read.
+func (r *Radio) Unsubscribe() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.subscribed {
+		return
+	}
+	r.call(request{Op: opUnsubscribe})
+	r.subscribed = false
+	for {
+		select {
+		case <-r.packets:
+		default:
+			return
+		}
+	}
+}
+
+// ReceivePacket waits with the given timeout for a packet
+// received by the server. It returns the packet and its metadata.
+// The packet's Data field is nil if no packet was received.
+func (r *Radio) ReceivePacket(timeout time.Duration) cc1101.Packet {
+	r.mu.Lock()
+	r.clearTimeout()
+	r.subscribe()
+	err := r.err
+	r.mu.Unlock()
+	if err != nil {
+		return cc1101.Packet{}
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case p := <-r.packets:
+		return p
+	case <-t.C:
+		r.SetError(ErrReceiveTimeout)
+		return cc1101.Packet{}
+	}
+}
+
+// Receive waits with the given timeout for a packet received by the server.
+// It returns the packet's data and RSSI.
+func (r *Radio) Receive(timeout time.Duration) ([]byte, int) {
+	p := r.ReceivePacket(timeout)
+	return p.Data, p.RSSI
+}
+
+// SendAndReceive transmits the given packet and waits with the given timeout
+// for a response, which is returned to this client only.
+// The server reduces the timeout to at most MaxReceiveTimeout.
+func (r *Radio) SendAndReceive(data []byte, timeout time.Duration) ([]byte, int) {
+	resp := r.do(request{Op: opSendReceive, Data: data, Timeout: timeout})
+	return resp.Data, resp.RSSI
+}
+
+// State returns the radio's state as a string.
+func (r *Radio) State() string {
+	return r.do(request{Op: opState}).State
+}
+
+// ReadStatus returns the status of the server and its radio.
+func (r *Radio) ReadStatus() (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp := r.call(request{Op: opStatus})
+	if r.err != nil {
+		return Status{}, r.err
+	}
+	if resp.Status == nil {
+		return Status{}, ErrBadResponse
+	}
+	return *resp.Status, nil
+}
+
+// ReadConfiguration reads the radio's configuration registers.
+func (r *Radio) ReadConfiguration() *cc1101.RFConfiguration {
+	return r.do(request{Op: opReadConfig}).Config
+}
+
+// WriteConfiguration writes the radio's configuration registers.
+// This affects all of the server's clients.
+func (r *Radio) WriteConfiguration(config *cc1101.RFConfiguration) {
+	r.do(request{Op: opWriteConfig, Config: config})
+}
+
+// Error returns the error state of the client.
+func (r *Radio) Error() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// SetError sets the error state of the client.
+func (r *Radio) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Name returns the radio's name.
+func (*Radio) Name() string {
+	return "CC1101"
+}
+
+// Device returns the address of the server's socket.
+func (r *Radio) Device() string {
+	if r.conn == nil {
+		return ""
+	}
+	return r.conn.RemoteAddr().String()
+}
@@ -0,0 +1,66 @@
+// Package remote shares a CC1101 radio between processes.
+// A Server owns the radio and serves requests from clients
+// over a Unix domain socket; a client Radio implements radio.Interface
+// by forwarding its operations to the server.
+//
+// Messages are JSON objects, one per line.
+// Each request carries an ID that is echoed in its response.
+// Packets received on behalf of subscribed clients are delivered
+// as messages with no ID.
+package remote
+
+import (
+	"time"
+
+	"github.com/ecc1/cc1101"
+)
+
+// DefaultSocket is the pathname of the server's socket,
+// unless overridden by the CC1101D_SOCKET environment variable.
+const DefaultSocket = "/run/cc1101d.sock"
+
+// Request operations.
+const (
+	opInit         = "init"
+	opReset        = "reset"
+	opFrequency    = "frequency"
+	opSetFrequency = "set-frequency"
+	opSend         = "send"
+	opSendReceive  = "send-receive"
+	opSubscribe    = "subscribe"
+	opUnsubscribe  = "unsubscribe"
+	opState        = "state"
+	opStatus       = "status"
+	opReadConfig   = "read-config"
+	opWriteConfig  = "write-config"
+)
+
+type request struct {
+	ID        uint64                  `json:"id"`
+	Op        string                  `json:"op"`
+	Frequency uint32                  `json:"frequency,omitempty"`
+	Data      []byte                  `json:"data,omitempty"`
+	Timeout   time.Duration           `json:"timeout,omitempty"`
+	Config    *cc1101.RFConfiguration `json:"config,omitempty"`
+}
+
+type response struct {
+	ID        uint64                  `json:"id,omitempty"`
+	Error     string                  `json:"error,omitempty"`
+	Timeout   bool                    `json:"timeout,omitempty"`
+	Frequency uint32                  `json:"frequency,omitempty"`
+	Data      []byte                  `json:"data,omitempty"`
+	RSSI      int                     `json:"rssi,omitempty"`
+	State     string                  `json:"state,omitempty"`
+	Status    *Status                 `json:"status,omitempty"`
+	Config    *cc1101.RFConfiguration `json:"config,omitempty"`
+	Packet    *cc1101.Packet          `json:"packet,omitempty"`
+}
+
+// Status contains the status of the server's radio.
+type Status struct {
+	cc1101.Status
+	Device      string // pathname of the radio's device
+	Clients     int    // number of connected clients
+	Subscribers int    // number of clients receiving packets
+}
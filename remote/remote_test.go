@@ -0,0 +1,255 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecc1/cc1101"
+)
+
+const testFrequency = 916600000
+
+func startServer(t *testing.T) (*cc1101.Emulator, string, func()) {
+	dir, err := ioutil.TempDir("", "cc1101d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "socket")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	e := cc1101.NewEmulator()
+	r := cc1101.OpenHardware(e)
+	r.Init(testFrequency)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	s := NewServer(r)
+	go s.Serve(l)
+	return e, path, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func dial(t *testing.T, path string) *Radio {
+	r := Dial(path)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	return r
+}
+
+func TestSendReceive(t *testing.T) {
+	e, path, stop := startServer(t)
+	defer stop()
+	rx1 := dial(t, path)
+	defer rx1.Close()
+	rx2 := dial(t, path)
+	defer rx2.Close()
+	tx := dial(t, path)
+	defer tx.Close()
+	rx1.Subscribe()
+	rx2.Subscribe()
+	data := []byte("hello, world")
+	e.Inject(append(data, 0))
+	for i, r := range []*Radio{rx1, rx2} {
+		p, _ := r.Receive(time.Second)
+		if r.Error() != nil {
+			t.Fatalf("client %d: %v", i+1, r.Error())
+		}
+		if !bytes.Equal(p, data) {
+			t.Errorf("client %d received %q, want %q", i+1, p, data)
+		}
+	}
+	tx.Send(data)
+	if tx.Error() != nil {
+		t.Fatal(tx.Error())
+	}
+	sent := e.Transmitted()
+	if len(sent) != 1 || !bytes.Equal(sent[0], append(data, 0, 0)) {
+		t.Errorf("transmitted %q, want %q", sent, data)
+	}
+	// The sender is not subscribed, so it times out.
+	if p, _ := tx.Receive(10 * time.Millisecond); p != nil || tx.Error() != ErrReceiveTimeout {
+		t.Errorf("Receive returned %q with error %v, want ErrReceiveTimeout", p, tx.Error())
+	}
+}
+
+func TestReceiveTimeout(t *testing.T) {
+	e, path, stop := startServer(t)
+	defer stop()
+	r := dial(t, path)
+	defer r.Close()
+	if p, _ := r.Receive(10 * time.Millisecond); p != nil || r.Error() != ErrReceiveTimeout {
+		t.Fatalf("Receive returned %q with error %v, want ErrReceiveTimeout", p, r.Error())
+	}
+	// A timeout does not prevent later requests.
+	data := []byte("after timeout")
+	r.Send(data)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	sent := e.Transmitted()
+	if len(sent) != 1 || !bytes.Equal(sent[0], append(data, 0, 0)) {
+		t.Errorf("transmitted %q, want %q", sent, data)
+	}
+	if f := r.Frequency(); f == 0 {
+		t.Errorf("Frequency() == 0 after timeout")
+	}
+	r.Receive(10 * time.Millisecond)
+	e.Inject(append(data, 0))
+	if p, _ := r.Receive(time.Second); !bytes.Equal(p, data) || r.Error() != nil {
+		t.Errorf("Receive returned %q with error %v after timeout, want %q", p, r.Error(), data)
+	}
+}
+
+func TestSendAndReceive(t *testing.T) {
+	e, path, stop := startServer(t)
+	defer stop()
+	r := dial(t, path)
+	defer r.Close()
+	response := []byte("response")
+	e.Inject(append(response, 0))
+	p, _ := r.SendAndReceive([]byte("request"), time.Second)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if !bytes.Equal(p, response) {
+		t.Errorf("received %q, want %q", p, response)
+	}
+	if p, _ := r.SendAndReceive([]byte("request"), 10*time.Millisecond); p != nil {
+		t.Errorf("received %q, want nothing", p)
+	}
+	// The server limits how long one client can hold the radio.
+	start := time.Now()
+	r.SendAndReceive([]byte("request"), time.Hour)
+	if d := time.Since(start); d > 2*MaxReceiveTimeout {
+		t.Errorf("SendAndReceive took %v, want at most %v", d, MaxReceiveTimeout)
+	}
+}
+
+func TestConfiguration(t *testing.T) {
+	_, path, stop := startServer(t)
+	defer stop()
+	r := dial(t, path)
+	defer r.Close()
+	other := dial(t, path)
+	defer other.Close()
+	if f := r.Frequency(); !near(f, testFrequency) {
+		t.Errorf("frequency == %d, want %d", f, testFrequency)
+	}
+	r.SetFrequency(868300000)
+	if f := other.Frequency(); !near(f, 868300000) {
+		t.Errorf("frequency == %d, want 868300000", f)
+	}
+	config := r.ReadConfiguration()
+	if config == nil {
+		t.Fatal(r.Error())
+	}
+	config.SYNC1 = 0x12
+	r.WriteConfiguration(config)
+	if c := other.ReadConfiguration(); c == nil || c.SYNC1 != 0x12 {
+		t.Errorf("configuration == %+v, want SYNC1 = 12", c)
+	}
+	if s := r.State(); s != "IDLE" {
+		t.Errorf("state == %s, want IDLE", s)
+	}
+	other.Subscribe()
+	st, err := r.ReadStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Clients != 2 || st.Subscribers != 1 {
+		t.Errorf("status == %+v, want 2 clients and 1 subscriber", st)
+	}
+	if r.Error() != nil || other.Error() != nil {
+		t.Errorf("errors == %v, %v", r.Error(), other.Error())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, path, stop := startServer(t)
+	defer stop()
+	r := dial(t, path)
+	other := dial(t, path)
+	defer other.Close()
+	// Errors are reported only to the client that caused them.
+	r.Send(make([]byte, 1000))
+	var se ServerError
+	if !errors.As(r.Error(), &se) || !strings.Contains(se.Error(), cc1101.ErrPacketTooLarge.Error()) {
+		t.Errorf("error == %v, want ServerError for large packet", r.Error())
+	}
+	if other.State(); other.Error() != nil {
+		t.Errorf("other client's error == %v", other.Error())
+	}
+	// The error state is sticky.
+	if f := r.Frequency(); f != 0 {
+		t.Errorf("frequency == %d with error set", f)
+	}
+	r.SetError(nil)
+	if f := r.Frequency(); !near(f, testFrequency) || r.Error() != nil {
+		t.Errorf("frequency == %d, error == %v", f, r.Error())
+	}
+	r.Close()
+	r.State()
+	if r.Error() == nil {
+		t.Error("no error after Close")
+	}
+	if r := Dial(filepath.Join(filepath.Dir(path), "missing")); r.Error() == nil {
+		t.Error("no error connecting to missing socket")
+	}
+}
+
+func TestMalformedResponse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cc1101d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "socket")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// A server that answers every request with an empty response.
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		dec := json.NewDecoder(conn)
+		enc := json.NewEncoder(conn)
+		for {
+			var req request
+			if dec.Decode(&req) != nil {
+				return
+			}
+			enc.Encode(response{ID: req.ID})
+		}
+	}()
+	r := dial(t, path)
+	defer r.Close()
+	if _, err := r.ReadStatus(); err != ErrBadResponse {
+		t.Errorf("ReadStatus error == %v, want %v", err, ErrBadResponse)
+	}
+}
+
+// near reports whether the frequency f is within
+// the synthesizer's resolution of want.
+func near(f, want uint32) bool {
+	const resolution = 400 // FXOSC / 2^16
+	return want-resolution < f && f < want+resolution
+}
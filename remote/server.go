@@ -0,0 +1,310 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ecc1/cc1101"
+	"github.com/ecc1/gpio"
+)
+
+const (
+	// Length of each period of listening on behalf of subscribers.
+	// Other requests wait at most this long for the radio.
+	listenWindow = 100 * time.Millisecond
+
+	// Number of received packets queued for each client.
+	packetQueueSize = 64
+)
+
+// MaxReceiveTimeout is the longest time the server waits for
+// the response to a SendAndReceive request, since the radio
+// is not available to other clients meanwhile.
+// Longer timeouts are reduced to it.
+const MaxReceiveTimeout = time.Second
+
+// Server shares a radio among clients.
+type Server struct {
+	r *cc1101.Radio
+
+	// mu serializes radio operations, so that the error state
+	// after each one can be reported to the client that requested it.
+	mu sync.Mutex
+
+	cmu     sync.Mutex // protects the following fields
+	clients map[*client]bool
+	subs    int
+	wake    chan struct{}
+	closed  bool
+	ln      []net.Listener
+	done    chan struct{}
+}
+
+// client is the server's side of a client connection.
+type client struct {
+	conn       net.Conn
+	wmu        sync.Mutex // serializes writes to conn
+	enc        *json.Encoder
+	packets    chan cc1101.Packet
+	subscribed bool // protected by Server.cmu
+}
+
+// NewServer returns a server for the given radio,
+// which should already be initialized.
+func NewServer(r *cc1101.Radio) *Server {
+	s := &Server{
+		r:       r,
+		clients: make(map[*client]bool),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go s.listen()
+	return s
+}
+
+// Serve accepts connections on the listener and serves their requests.
+// It returns when the listener fails or the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.cmu.Lock()
+	if s.closed {
+		s.cmu.Unlock()
+		return errServerClosed
+	}
+	s.ln = append(s.ln, l)
+	s.cmu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.cmu.Lock()
+			closed := s.closed
+			s.cmu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		c := &client{
+			conn:    conn,
+			enc:     json.NewEncoder(conn),
+			packets: make(chan cc1101.Packet, packetQueueSize),
+		}
+		s.cmu.Lock()
+		s.clients[c] = true
+		s.cmu.Unlock()
+		go s.serve(c)
+	}
+}
+
+var errServerClosed = errors.New("server closed")
+
+// Close stops the server and closes its listeners and client connections.
+// It does not close the radio.
+func (s *Server) Close() {
+	s.cmu.Lock()
+	if s.closed {
+		s.cmu.Unlock()
+		return
+	}
+	s.closed = true
+	for _, l := range s.ln {
+		l.Close()
+	}
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	close(s.done)
+	s.cmu.Unlock()
+}
+
+func (s *Server) serve(c *client) {
+	go s.deliver(c)
+	defer func() {
+		s.cmu.Lock()
+		if c.subscribed {
+			s.subs--
+		}
+		delete(s.clients, c)
+		close(c.packets)
+		s.cmu.Unlock()
+		c.conn.Close()
+	}()
+	dec := json.NewDecoder(bufio.NewReader(c.conn))
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		resp := s.handle(c, req)
+		resp.ID = req.ID
+		if c.send(resp) != nil {
+			return
+		}
+	}
+}
+
+// deliver sends packets queued for the client until its connection is closed.
+func (s *Server) deliver(c *client) {
+	for p := range c.packets {
+		p := p
+		if c.send(response{Packet: &p}) != nil {
+			c.conn.Close()
+		}
+	}
+}
+
+func (c *client) send(resp response) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.enc.Encode(resp)
+}
+
+func (s *Server) handle(c *client, req request) response {
+	switch req.Op {
+	case opSubscribe, opUnsubscribe:
+		s.subscribe(c, req.Op == opSubscribe)
+		return response{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.r
+	var resp response
+	switch req.Op {
+	case opInit:
+		r.Init(req.Frequency)
+	case opReset:
+		r.Reset()
+	case opFrequency:
+		resp.Frequency = r.Frequency()
+	case opSetFrequency:
+		r.SetFrequency(req.Frequency)
+	case opSend:
+		r.Send(req.Data)
+	case opSendReceive:
+		timeout := req.Timeout
+		if timeout > MaxReceiveTimeout {
+			timeout = MaxReceiveTimeout
+		}
+		resp.Data, resp.RSSI = r.SendAndReceive(req.Data, timeout)
+	case opState:
+		resp.State = r.State()
+	case opStatus:
+		st, err := r.ReadStatus()
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		resp.Status = &Status{Status: st, Device: r.Device()}
+		s.cmu.Lock()
+		resp.Status.Clients = len(s.clients)
+		resp.Status.Subscribers = s.subs
+		s.cmu.Unlock()
+	case opReadConfig:
+		resp.Config = r.ReadConfiguration()
+	case opWriteConfig:
+		if req.Config == nil {
+			return response{Error: "missing configuration"}
+		}
+		r.WriteConfiguration(req.Config)
+	default:
+		return response{Error: "unknown operation " + req.Op}
+	}
+	// Report the error to this client only.
+	if err := r.Error(); err != nil {
+		r.SetError(nil)
+		if isTimeout(err) {
+			resp.Timeout = true
+		} else {
+			resp.Error = err.Error()
+		}
+	}
+	return resp
+}
+
+func isTimeout(err error) bool {
+	_, ok := err.(gpio.TimeoutError)
+	return ok || err == cc1101.ErrInterruptTimeout
+}
+
+func (s *Server) subscribe(c *client, on bool) {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+	if c.subscribed == on {
+		return
+	}
+	c.subscribed = on
+	if on {
+		s.subs++
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	} else {
+		s.subs--
+	}
+}
+
+// listen receives packets while there are subscribers,
+// in periods of listenWindow so that other requests can be served,
+// and delivers them to all subscribers.
+func (s *Server) listen() {
+	for {
+		s.cmu.Lock()
+		subs := s.subs
+		s.cmu.Unlock()
+		if subs == 0 {
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		p, err := s.receive()
+		switch err {
+		case nil:
+			s.broadcast(p)
+		case context.DeadlineExceeded:
+		default:
+			log.Print(err)
+			// Don't spin if the radio keeps failing.
+			time.Sleep(listenWindow)
+		}
+	}
+}
+
+func (s *Server) receive() (cc1101.Packet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), listenWindow)
+	defer cancel()
+	p, err := s.r.ReceiveContext(ctx)
+	if err != nil {
+		s.r.SetError(nil)
+	}
+	return p, err
+}
+
+func (s *Server) broadcast(p cc1101.Packet) {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+	for c := range s.clients {
+		if !c.subscribed {
+			continue
+		}
+		select {
+		case c.packets <- p:
+		default:
+			// The client is not keeping up; drop the packet.
+		}
+	}
+}
@@ -2,7 +2,9 @@ package cc1101
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"math"
 	"unsafe"
 )
 
@@ -14,6 +16,19 @@ var (
 	ErrTXFIFOUnderflow = errors.New("TXFIFO underflow")
 )
 
+// RangeError indicates a requested RF parameter
+// that is not supported by the radio.
+type RangeError struct {
+	Name  string
+	Value uint32
+	Min   uint32
+	Max   uint32
+}
+
+func (e RangeError) Error() string {
+	return fmt.Sprintf("%s %d out of range (%d to %d)", e.Name, e.Value, e.Min, e.Max)
+}
+
 // Bytes returns the RFConfiguration as a byte slice.
 func (config *RFConfiguration) Bytes() []byte {
 	return (*[TEST0 - IOCFG2 + 1]byte)(unsafe.Pointer(config))[:]
@@ -21,7 +36,13 @@ func (config *RFConfiguration) Bytes() []byte {
 
 // ReadConfiguration reads the current RFConfiguration from the radio.
 func (r *Radio) ReadConfiguration() *RFConfiguration {
-	if r.Error() != nil {
+	r.hold()
+	defer r.release()
+	return r.readConfiguration()
+}
+
+func (r *Radio) readConfiguration() *RFConfiguration {
+	if r.error() != nil {
 		return nil
 	}
 	regs := r.hw.ReadBurst(IOCFG2, TEST0-IOCFG2+1)
@@ -30,14 +51,40 @@ func (r *Radio) ReadConfiguration() *RFConfiguration {
 
 // WriteConfiguration writes the given RFConfiguration to the radio.
 func (r *Radio) WriteConfiguration(config *RFConfiguration) {
+	r.hold()
+	defer r.release()
+	r.writeConfiguration(config)
+}
+
+func (r *Radio) writeConfiguration(config *RFConfiguration) {
+	r.clearCalibration(false)
 	r.hw.WriteBurst(IOCFG2, config.Bytes())
 }
 
+// RF parameters used by InitRF.
+// The register values are computed from the radio's crystal frequency,
+// so they are only approximated for crystals other than 24 MHz.
+const (
+	pumpIF             = 140625 // Hz
+	pumpChannelBW      = 300000 // Hz
+	pumpDataRate       = 16384  // Baud
+	pumpChannelSpacing = 103271 // Hz
+)
+
 // InitRF initializes the radio to communicate with
 // a Medtronic insulin pump at the given frequency.
 func (r *Radio) InitRF(frequency uint32) {
+	r.hold()
+	defer r.release()
+	r.initRF(frequency)
+}
+
+func (r *Radio) initRF(frequency uint32) {
 	rf := ResetRFConfiguration
-	fb := frequencyToRegisters(frequency)
+	fb := frequencyToRegisters(frequency, r.fxosc)
+	chanbwE, chanbwM := channelBandwidthToRegisters(pumpChannelBW, r.fxosc)
+	drateE, drateM := dataRateToRegisters(pumpDataRate, r.fxosc)
+	chanspcE, chanspcM := channelSpacingToRegisters(pumpChannelSpacing, r.fxosc)
 
 	rf.IOCFG2 = 0x2F
 	rf.IOCFG1 = 0x2F
@@ -55,35 +102,35 @@ func (r *Radio) InitRF(frequency uint32) {
 	rf.PKTCTRL0 = PKTCTRL0_LENGTH_CONFIG_INFINITE
 
 	// Intermediate frequency
-	// 0x06 * 24 MHz / 2^10 == 140625 Hz
-	rf.FSCTRL1 = 0x06
+	// With a 24 MHz crystal: 0x06 * 24 MHz / 2^10 == 140625 Hz
+	rf.FSCTRL1 = ifToRegister(pumpIF, r.fxosc)
 
 	rf.FREQ2 = fb[0]
 	rf.FREQ1 = fb[1]
 	rf.FREQ0 = fb[2]
 
-	// CHANBW_E = 1, CHANBW_M = 1, DRATE_E = 9
+	// With a 24 MHz crystal: CHANBW_E = 1, CHANBW_M = 1, DRATE_E = 9
 	// Channel BW = 24 MHz / (8 * (4 + CHANBW_M) * 2^CHANBW_E) == 300 kHz
-	rf.MDMCFG4 = 1<<MDMCFG4_CHANBW_E_SHIFT |
-		1<<MDMCFG4_CHANBW_M_SHIFT |
-		9<<MDMCFG4_DRATE_E_SHIFT
+	rf.MDMCFG4 = chanbwE<<MDMCFG4_CHANBW_E_SHIFT |
+		chanbwM<<MDMCFG4_CHANBW_M_SHIFT |
+		drateE<<MDMCFG4_DRATE_E_SHIFT
 
-	// DRATE_M = 102 (0x66)
+	// With a 24 MHz crystal: DRATE_M = 102 (0x66)
 	// Data rate = (256 + DRATE_M) * 2^DRATE_E * 24 MHz / 2^28 == 16388 Baud
-	rf.MDMCFG3 = 0x66
+	rf.MDMCFG3 = drateM
 
 	rf.MDMCFG2 = MDMCFG2_DEM_DCFILT_ON |
 		MDMCFG2_MOD_FORMAT_ASK_OOK |
 		MDMCFG2_SYNC_MODE_30_32_THRES
 
-	// CHANSPC_E = 2
+	// With a 24 MHz crystal: CHANSPC_E = 2
 	rf.MDMCFG1 = MDMCFG1_FEC_DIS |
 		MDMCFG1_NUM_PREAMBLE_24 |
-		2<<MDMCFG1_CHANSPC_E_SHIFT
+		chanspcE<<MDMCFG1_CHANSPC_E_SHIFT
 
-	// CHANSPC_M = 26 (0x1A)
+	// With a 24 MHz crystal: CHANSPC_M = 26 (0x1A)
 	// Channel spacing = (256 + CHANSPC_M) * 2^CHANSPC_E * 24 MHz / 2^18 == 103271 Hz
-	rf.MDMCFG0 = 0x1A
+	rf.MDMCFG0 = chanspcM
 
 	rf.MCSM2 = MCSM2_RX_TIME_END_OF_PACKET
 
@@ -135,66 +182,356 @@ func (r *Radio) InitRF(frequency uint32) {
 	rf.TEST1 = TEST1_RX_LOW_DATA_RATE_MAGIC
 	rf.TEST0 = 2<<2 | 1 // disable VCO selection calibration
 
-	r.WriteConfiguration(&rf)
+	r.writeConfiguration(&rf)
+	r.packetFormat = ZeroTerminated
+	r.packetLength = maxPacketSize
+	r.crc = false
+	r.address = 0
+	r.addressFilter = AddressCheckNone
+	r.wor = WakeOnRadio{}
+	r.afc = AFCOff
+	r.freqEst = 0
 
 	// Power amplifier output settings (see section 24 of the data sheet)
 	r.hw.WriteBurst(PATABLE, []byte{0x00, 0xC0})
+
+	r.applyProfile()
+}
+
+// CrystalFrequency returns the frequency of the radio's crystal, in Hertz,
+// including the correction in the radio's profile.
+func (r *Radio) CrystalFrequency() uint32 {
+	r.hold()
+	defer r.release()
+	return r.fxosc
+}
+
+// Range of crystal frequencies supported by the radio, in Hertz.
+// The data sheet specifies 26 to 27 MHz, but 24 MHz crystals
+// are commonly used (see FXOSC).
+const (
+	minCrystalFrequency = 24000000
+	maxCrystalFrequency = 28000000
+)
+
+// checkCrystalFrequency returns a RangeError if the given
+// crystal frequency is not supported by the radio.
+func checkCrystalFrequency(fxosc float64) error {
+	if fxosc >= minCrystalFrequency && fxosc <= maxCrystalFrequency {
+		return nil
+	}
+	v := uint32(0)
+	if fxosc > math.MaxUint32 {
+		v = math.MaxUint32
+	} else if fxosc > 0 {
+		v = uint32(fxosc)
+	}
+	return RangeError{Name: "crystal frequency", Value: v, Min: minCrystalFrequency, Max: maxCrystalFrequency}
+}
+
+// SetCrystalFrequency sets the nominal frequency of the radio's crystal, in Hertz,
+// to which the correction in the radio's profile is applied.
+// It must be called before InitRF for the RF parameters to be correct.
+// Frequencies outside the range supported by the radio
+// set the error state to a RangeError.
+func (r *Radio) SetCrystalFrequency(fxosc uint32) {
+	r.hold()
+	defer r.release()
+	r.setCrystalFrequency(fxosc)
+}
+
+func (r *Radio) setCrystalFrequency(fxosc uint32) {
+	if err := checkCrystalFrequency(float64(fxosc)); err != nil {
+		r.setError(err)
+		return
+	}
+	f, err := correctCrystal(fxosc, r.profile.CrystalPPM)
+	if err != nil {
+		r.setError(err)
+		return
+	}
+	r.fxosc = f
 }
 
 // Frequency returns the radio's current frequency, in Hertz.
 func (r *Radio) Frequency() uint32 {
-	return registersToFrequency(r.hw.ReadBurst(FREQ2, 3))
+	r.hold()
+	defer r.release()
+	return r.frequency()
 }
 
-func registersToFrequency(freq []byte) uint32 {
+func (r *Radio) frequency() uint32 {
+	return registersToFrequency(r.hw.ReadBurst(FREQ2, 3), r.fxosc)
+}
+
+func registersToFrequency(freq []byte, fxosc uint32) uint32 {
 	f := uint32(freq[0])<<16 + uint32(freq[1])<<8 + uint32(freq[2])
-	return uint32(uint64(f) * FXOSC >> 16)
+	return uint32(uint64(f) * uint64(fxosc) >> 16)
 }
 
 // SetFrequency sets the radio to the given frequency, in Hertz.
+// It discards the calibration cache used for frequency hopping.
 func (r *Radio) SetFrequency(freq uint32) {
-	r.hw.WriteBurst(FREQ2, frequencyToRegisters(freq))
+	r.hold()
+	defer r.release()
+	r.clearCalibration(true)
+	r.hw.WriteBurst(FREQ2, frequencyToRegisters(freq, r.fxosc))
 }
 
-func frequencyToRegisters(freq uint32) []byte {
-	f := (uint64(freq)<<16 + FXOSC/2) / FXOSC
+func frequencyToRegisters(freq uint32, fxosc uint32) []byte {
+	f := (uint64(freq)<<16 + uint64(fxosc)/2) / uint64(fxosc)
 	return []byte{byte(f >> 16), byte(f >> 8), byte(f)}
 }
 
 // ReadIF returns the radio's intermediate frequency, in Hertz.
 func (r *Radio) ReadIF() uint32 {
+	r.hold()
+	defer r.release()
+	return r.readIF()
+}
+
+func (r *Radio) readIF() uint32 {
 	f := r.hw.ReadRegister(FSCTRL1)
-	return uint32(uint64(f) * FXOSC >> 10)
+	return registerToIF(f, r.fxosc)
+}
+
+func registerToIF(f byte, fxosc uint32) uint32 {
+	return uint32(uint64(f) * uint64(fxosc) >> 10)
+}
+
+// ifToRegister returns the FSCTRL1 value closest to the given
+// intermediate frequency.
+func ifToRegister(freq uint32, fxosc uint32) byte {
+	best := byte(0)
+	for f := byte(0); f < 32; f++ {
+		if absDiff(registerToIF(f, fxosc), freq) < absDiff(registerToIF(best, fxosc), freq) {
+			best = f
+		}
+	}
+	return best
 }
 
 // ReadChannelParams returns the radio's channel bandwidth and data rate.
 func (r *Radio) ReadChannelParams() (uint32, uint32) {
+	r.hold()
+	defer r.release()
+	return r.readChannelParams()
+}
+
+func (r *Radio) readChannelParams() (uint32, uint32) {
 	m4 := r.hw.ReadRegister(MDMCFG4)
 	chanbwExp := (m4 >> MDMCFG4_CHANBW_E_SHIFT) & 0x3
 	chanbwMant := (m4 >> MDMCFG4_CHANBW_M_SHIFT) & 0x3
 	drateExp := (m4 >> MDMCFG4_DRATE_E_SHIFT) & 0xF
 	drateMant := r.hw.ReadRegister(MDMCFG3)
-	chanbw := uint32(FXOSC / ((4 + uint64(chanbwMant)) << (chanbwExp + 3)))
-	drate := uint32(((256 + uint64(drateMant)) << drateExp * FXOSC) >> 28)
+	chanbw := registersToChannelBandwidth(chanbwExp, chanbwMant, r.fxosc)
+	drate := registersToDataRate(drateExp, drateMant, r.fxosc)
 	return chanbw, drate
 }
 
+func registersToChannelBandwidth(e, m byte, fxosc uint32) uint32 {
+	return uint32(uint64(fxosc) / ((4 + uint64(m)) << (e + 3)))
+}
+
+// channelBandwidthToRegisters returns the CHANBW_E and CHANBW_M values
+// closest to the given channel bandwidth.
+func channelBandwidthToRegisters(bw uint32, fxosc uint32) (byte, byte) {
+	bestE, bestM := byte(0), byte(0)
+	for e := byte(0); e < 4; e++ {
+		for m := byte(0); m < 4; m++ {
+			if absDiff(registersToChannelBandwidth(e, m, fxosc), bw) < absDiff(registersToChannelBandwidth(bestE, bestM, fxosc), bw) {
+				bestE, bestM = e, m
+			}
+		}
+	}
+	return bestE, bestM
+}
+
+func registersToDataRate(e, m byte, fxosc uint32) uint32 {
+	return uint32(((256 + uint64(m)) << e * uint64(fxosc)) >> 28)
+}
+
+// dataRateToRegisters returns the DRATE_E and DRATE_M values
+// closest to the given data rate.
+func dataRateToRegisters(baud uint32, fxosc uint32) (byte, byte) {
+	bestE, bestM := byte(0), byte(0)
+	for e := byte(0); e < 16; e++ {
+		for m := 0; m < 256; m++ {
+			if absDiff(registersToDataRate(e, byte(m), fxosc), baud) < absDiff(registersToDataRate(bestE, bestM, fxosc), baud) {
+				bestE, bestM = e, byte(m)
+			}
+		}
+	}
+	return bestE, bestM
+}
+
+// Channel filter bandwidth and channel spacing limits from the data sheet,
+// in Hertz.
+const (
+	minChannelBandwidth = 58000
+	maxChannelBandwidth = 812000
+	minChannelSpacing   = 25000
+	maxChannelSpacing   = 405000
+)
+
+// SetChannelBandwidth sets the radio's receiver channel filter bandwidth
+// to the representable value closest to the given bandwidth, in Hertz.
+// The bandwidth must be within the data sheet range (58 kHz to 812 kHz)
+// and representable with the current crystal frequency.
+// It returns the bandwidth that was achieved.
+func (r *Radio) SetChannelBandwidth(bw uint32) uint32 {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return 0
+	}
+	min := maxUint32(minChannelBandwidth, registersToChannelBandwidth(3, 3, r.fxosc))
+	max := minUint32(maxChannelBandwidth, registersToChannelBandwidth(0, 0, r.fxosc))
+	if bw < min || bw > max {
+		r.setError(RangeError{Name: "channel bandwidth", Value: bw, Min: min, Max: max})
+		return 0
+	}
+	e, m := channelBandwidthToRegisters(bw, r.fxosc)
+	m4 := r.hw.ReadRegister(MDMCFG4) & (0xF << MDMCFG4_DRATE_E_SHIFT)
+	r.hw.WriteRegister(MDMCFG4, m4|e<<MDMCFG4_CHANBW_E_SHIFT|m<<MDMCFG4_CHANBW_M_SHIFT)
+	return registersToChannelBandwidth(e, m, r.fxosc)
+}
+
+// dataRateLimits returns the range of data rates, in Baud,
+// that the data sheet specifies for the given modulation format.
+func dataRateLimits(mod Modulation) (uint32, uint32) {
+	switch mod {
+	case ModulationGFSK, ModulationOOK:
+		return 600, 250000
+	case Modulation4FSK:
+		return 600, 300000
+	case ModulationMSK:
+		return 26000, 500000
+	default:
+		return 600, 500000
+	}
+}
+
+// SetDataRate sets the radio's data rate to the representable value
+// closest to the given rate, in Baud.
+// The rate must be within the data sheet range for the current
+// modulation format (for example, 0.6 to 500 kBaud for 2-FSK
+// and 0.6 to 250 kBaud for OOK), so the modulation should be set first.
+// It returns the data rate that was achieved.
+func (r *Radio) SetDataRate(baud uint32) uint32 {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return 0
+	}
+	min, max := dataRateLimits(Modulation(r.hw.ReadRegister(MDMCFG2) & MDMCFG2_MOD_FORMAT_MASK))
+	min = maxUint32(min, registersToDataRate(0, 0, r.fxosc))
+	max = minUint32(max, registersToDataRate(15, 255, r.fxosc))
+	if baud < min || baud > max {
+		r.setError(RangeError{Name: "data rate", Value: baud, Min: min, Max: max})
+		return 0
+	}
+	e, m := dataRateToRegisters(baud, r.fxosc)
+	m4 := r.hw.ReadRegister(MDMCFG4) &^ (0xF << MDMCFG4_DRATE_E_SHIFT)
+	r.hw.WriteBurst(MDMCFG4, []byte{m4 | e<<MDMCFG4_DRATE_E_SHIFT, m << MDMCFG3_DRATE_M_SHIFT})
+	r.setTestRegisters()
+	return registersToDataRate(e, m, r.fxosc)
+}
+
 // ReadModemConfig returns the radio's modem configuration:
 // whether FEC is enabled, the minimum preamble length, and the channel spacing.
 func (r *Radio) ReadModemConfig() (bool, uint8, uint32) {
+	r.hold()
+	defer r.release()
+	return r.readModemConfig()
+}
+
+func (r *Radio) readModemConfig() (bool, uint8, uint32) {
 	m1 := r.hw.ReadRegister(MDMCFG1)
 	fec := m1&MDMCFG1_FEC_EN != 0
 	minPreamble := numPreamble[(m1&MDMCFG1_NUM_PREAMBLE_MASK)>>4]
 	chanspcExp := m1 & MDMCFG1_CHANSPC_E_MASK
 	chanspcMant := r.hw.ReadRegister(MDMCFG0)
-	chanspc := uint32(((256 + uint64(chanspcMant)) << chanspcExp * FXOSC) >> 18)
+	chanspc := registersToChannelSpacing(chanspcExp, chanspcMant, r.fxosc)
 	return fec, minPreamble, chanspc
 }
 
+func registersToChannelSpacing(e, m byte, fxosc uint32) uint32 {
+	return uint32(((256 + uint64(m)) << e * uint64(fxosc)) >> 18)
+}
+
+// channelSpacingToRegisters returns the CHANSPC_E and CHANSPC_M values
+// closest to the given channel spacing.
+func channelSpacingToRegisters(spacing uint32, fxosc uint32) (byte, byte) {
+	bestE, bestM := byte(0), byte(0)
+	for e := byte(0); e < 4; e++ {
+		for m := 0; m < 256; m++ {
+			if absDiff(registersToChannelSpacing(e, byte(m), fxosc), spacing) < absDiff(registersToChannelSpacing(bestE, bestM, fxosc), spacing) {
+				bestE, bestM = e, byte(m)
+			}
+		}
+	}
+	return bestE, bestM
+}
+
+// SetChannelSpacing sets the radio's channel spacing to the representable
+// value closest to the given spacing, in Hertz.
+// The spacing must be within the data sheet range (25 kHz to 405 kHz)
+// and representable with the current crystal frequency.
+// It returns the channel spacing that was achieved.
+func (r *Radio) SetChannelSpacing(spacing uint32) uint32 {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return 0
+	}
+	min := maxUint32(minChannelSpacing, registersToChannelSpacing(0, 0, r.fxosc))
+	max := minUint32(maxChannelSpacing, registersToChannelSpacing(3, 255, r.fxosc))
+	if spacing < min || spacing > max {
+		r.setError(RangeError{Name: "channel spacing", Value: spacing, Min: min, Max: max})
+		return 0
+	}
+	e, m := channelSpacingToRegisters(spacing, r.fxosc)
+	m1 := r.hw.ReadRegister(MDMCFG1) &^ MDMCFG1_CHANSPC_E_MASK
+	r.hw.WriteBurst(MDMCFG1, []byte{m1 | e<<MDMCFG1_CHANSPC_E_SHIFT, m << MDMCFG0_CHANSPC_M_SHIFT})
+	return registersToChannelSpacing(e, m, r.fxosc)
+}
+
+func minUint32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
 // ReadRSSI returns the radio's RSSI, in dBm.
 func (r *Radio) ReadRSSI() int {
+	r.hold()
+	defer r.release()
+	return r.readRSSI()
+}
+
+func (r *Radio) readRSSI() int {
+	return rssiToDBm(r.hw.ReadRegister(RSSI)) + r.profile.RSSIOffset
+}
+
+// rssiToDBm converts an RSSI register or status byte value to dBm.
+func rssiToDBm(rssi byte) int {
 	const rssiOffset = 74 // see data sheet section 17.3
-	rssi := r.hw.ReadRegister(RSSI)
 	d := int(rssi)
 	if d >= 128 {
 		d -= 256
@@ -204,6 +541,12 @@ func (r *Radio) ReadRSSI() int {
 
 // ReadPATable returns the contents of PATABLE.
 func (r *Radio) ReadPATable() []byte {
+	r.hold()
+	defer r.release()
+	return r.readPATable()
+}
+
+func (r *Radio) readPATable() []byte {
 	return r.hw.ReadBurst(PATABLE, 8)
 }
 
@@ -212,9 +555,15 @@ func (r *Radio) ReadPATable() []byte {
 // (per section 20 of the data sheet)
 // and detects RXFIFO overflow.
 func (r *Radio) ReadNumRXBytes() byte {
+	r.hold()
+	defer r.release()
+	return r.readNumRXBytes()
+}
+
+func (r *Radio) readNumRXBytes() byte {
 	last := byte(0)
 	read := false
-	for r.Error() == nil {
+	for r.error() == nil {
 		n := r.hw.ReadRegister(RXBYTES)
 		if n&RXFIFO_OVERFLOW != 0 {
 			r.err = ErrRXFIFOOverflow
@@ -232,6 +581,12 @@ func (r *Radio) ReadNumRXBytes() byte {
 // ReadNumTXBytes reads the TXBYTES register
 // and detects TXFIFO underflow.
 func (r *Radio) ReadNumTXBytes() byte {
+	r.hold()
+	defer r.release()
+	return r.readNumTXBytes()
+}
+
+func (r *Radio) readNumTXBytes() byte {
 	n := r.hw.ReadRegister(TXBYTES)
 	if n&TXFIFO_UNDERFLOW != 0 {
 		r.err = ErrTXFIFOUnderflow
@@ -240,24 +595,24 @@ func (r *Radio) ReadNumTXBytes() byte {
 }
 
 func (r *Radio) changeState(strobe byte, desired byte) {
-	r.SetError(nil)
-	s := r.ReadState()
+	r.setError(nil)
+	s := r.readState()
 	if s == desired {
 		return
 	}
 	if verbose {
 		log.Printf("change from %s to %s", StateName(s), StateName(desired))
 	}
-	for r.Error() == nil {
+	for r.error() == nil {
 		switch s {
 		case desired:
 			return
 		case STATE_RXFIFO_OVERFLOW:
-			s = r.Strobe(SFRX)
+			s = r.strobe(SFRX)
 		case STATE_TXFIFO_UNDERFLOW:
-			s = r.Strobe(SFTX)
+			s = r.strobe(SFTX)
 		default:
-			s = r.Strobe(strobe)
+			s = r.strobe(strobe)
 		}
 		s = (s >> STATE_SHIFT) & STATE_MASK
 		if verbose {
@@ -268,12 +623,24 @@ func (r *Radio) changeState(strobe byte, desired byte) {
 
 // State returns the radio's current state as a string.
 func (r *Radio) State() string {
-	return StateName(r.ReadState())
+	r.hold()
+	defer r.release()
+	return r.state()
+}
+
+func (r *Radio) state() string {
+	return StateName(r.readState())
 }
 
 // ReadState returns the radio's current state.
 func (r *Radio) ReadState() byte {
-	status := r.Strobe(SNOP)
+	r.hold()
+	defer r.release()
+	return r.readState()
+}
+
+func (r *Radio) readState() byte {
+	status := r.strobe(SNOP)
 	return (status >> STATE_SHIFT) & STATE_MASK
 }
 
@@ -284,6 +651,8 @@ func StateName(state byte) string {
 
 // ReadMARCState returns the radio's MARC state.
 func (r *Radio) ReadMARCState() byte {
+	r.hold()
+	defer r.release()
 	return r.hw.ReadRegister(MARCSTATE) & MARCSTATE_MASK
 }
 
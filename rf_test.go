@@ -20,11 +20,11 @@ func TestFrequency(t *testing.T) {
 		{916600000, []byte{0x26, 0x31, 0x11}, 916599975},
 	}
 	for _, c := range cases {
-		b := frequencyToRegisters(c.f)
+		b := frequencyToRegisters(c.f, FXOSC)
 		if !bytes.Equal(b, c.b) {
 			t.Errorf("frequencyToRegisters(%d) == % X, want % X", c.f, b, c.b)
 		}
-		f := registersToFrequency(c.b)
+		f := registersToFrequency(c.b, FXOSC)
 		if c.fApprox == 0 {
 			if f != c.f {
 				t.Errorf("registersToFrequency(% X) == %d, want %d", c.b, f, c.f)
@@ -36,3 +36,246 @@ func TestFrequency(t *testing.T) {
 		}
 	}
 }
+
+func TestFrequency26MHz(t *testing.T) {
+	const fxosc = 26000000
+	cases := []struct {
+		f       uint32
+		b       []byte
+		fApprox uint32
+	}{
+		{315000000, []byte{0x0C, 0x1D, 0x8A}, 315000061},
+		{433920000, []byte{0x10, 0xB0, 0x71}, 433919830},
+		{868000000, []byte{0x21, 0x62, 0x76}, 867999938},
+		{916600000, []byte{0x23, 0x40, 0xFC}, 916599975},
+	}
+	for _, c := range cases {
+		b := frequencyToRegisters(c.f, fxosc)
+		if !bytes.Equal(b, c.b) {
+			t.Errorf("frequencyToRegisters(%d) == % X, want % X", c.f, b, c.b)
+		}
+		f := registersToFrequency(c.b, fxosc)
+		if f != c.fApprox {
+			t.Errorf("registersToFrequency(% X) == %d, want %d", c.b, f, c.fApprox)
+		}
+	}
+}
+
+func TestCrystalFrequency(t *testing.T) {
+	// Register values written by InitRF with a 24 MHz crystal.
+	r, _ := openEmulator(t)
+	r.InitRF(916600000)
+	rf := r.ReadConfiguration()
+	want := []struct {
+		name string
+		have byte
+		want byte
+	}{
+		{"FSCTRL1", rf.FSCTRL1, 0x06},
+		{"MDMCFG4", rf.MDMCFG4, 0x59},
+		{"MDMCFG3", rf.MDMCFG3, 0x66},
+		{"MDMCFG1", rf.MDMCFG1, 0x72},
+		{"MDMCFG0", rf.MDMCFG0, 0x1A},
+	}
+	for _, c := range want {
+		if c.have != c.want {
+			t.Errorf("%s == %02X, want %02X", c.name, c.have, c.want)
+		}
+	}
+	chanbw, drate := r.ReadChannelParams()
+	_, _, chanspc := r.ReadModemConfig()
+	ifreq := r.ReadIF()
+
+	// The same RF parameters, within register resolution, with a 26 MHz crystal.
+	r, _ = openEmulator(t)
+	r.SetCrystalFrequency(26000000)
+	r.InitRF(916600000)
+	if f := r.Frequency(); absDiff(f, 916600000) > 400 {
+		t.Errorf("26 MHz: Frequency() == %d, want 916600000", f)
+	}
+	chanbw26, drate26 := r.ReadChannelParams()
+	_, _, chanspc26 := r.ReadModemConfig()
+	cases := []struct {
+		name      string
+		have      uint32
+		want      uint32
+		tolerance uint32
+	}{
+		{"IF", r.ReadIF(), ifreq, 13000},
+		{"channel bandwidth", chanbw26, chanbw, 30000},
+		{"data rate", drate26, drate, 30},
+		{"channel spacing", chanspc26, chanspc, 200},
+	}
+	for _, c := range cases {
+		if absDiff(c.have, c.want) > c.tolerance {
+			t.Errorf("26 MHz: %s == %d, want %d", c.name, c.have, c.want)
+		}
+	}
+}
+
+func TestCrystalFrequencyRange(t *testing.T) {
+	for _, fxosc := range []uint32{0, 1000, 23999999, 28000001, 1 << 31} {
+		r, _ := openEmulator(t)
+		r.SetCrystalFrequency(fxosc)
+		if _, ok := r.Error().(RangeError); !ok {
+			t.Errorf("SetCrystalFrequency(%d): error == %v, want RangeError", fxosc, r.Error())
+		}
+		if f := r.CrystalFrequency(); f != FXOSC {
+			t.Errorf("SetCrystalFrequency(%d) changed crystal frequency to %d", fxosc, f)
+		}
+		// The radio is still usable.
+		r.SetError(nil)
+		r.InitRF(868000000)
+		if r.Error() != nil {
+			t.Errorf("InitRF after SetCrystalFrequency(%d): %v", fxosc, r.Error())
+		}
+	}
+}
+
+func TestDataRate(t *testing.T) {
+	cases := []struct {
+		fxosc    uint32
+		baud     uint32
+		e, m     byte
+		achieved uint32
+	}{
+		{24000000, 1200, 5, 164, 1201},
+		{24000000, 4800, 7, 163, 4795},
+		{24000000, 16384, 9, 102, 16387},
+		{24000000, 38400, 10, 163, 38360},
+		{24000000, 100000, 12, 17, 99975},
+		{24000000, 250000, 13, 85, 249755},
+		{26000000, 1200, 5, 131, 1199},
+		{26000000, 38400, 10, 131, 38383},
+		{26000000, 100000, 11, 248, 99975},
+		{26000000, 500000, 14, 59, 499877},
+	}
+	for _, c := range cases {
+		e, m := dataRateToRegisters(c.baud, c.fxosc)
+		if e != c.e || m != c.m {
+			t.Errorf("dataRateToRegisters(%d, %d) == (%d, %d), want (%d, %d)", c.baud, c.fxosc, e, m, c.e, c.m)
+		}
+		baud := registersToDataRate(c.e, c.m, c.fxosc)
+		if baud != c.achieved {
+			t.Errorf("registersToDataRate(%d, %d, %d) == %d, want %d", c.e, c.m, c.fxosc, baud, c.achieved)
+		}
+	}
+}
+
+func TestChannelBandwidth(t *testing.T) {
+	cases := []struct {
+		fxosc    uint32
+		bw       uint32
+		e, m     byte
+		achieved uint32
+	}{
+		{24000000, 58000, 3, 3, 53571},
+		{24000000, 100000, 3, 0, 93750},
+		{24000000, 203000, 1, 3, 214285},
+		{24000000, 300000, 1, 1, 300000},
+		{24000000, 541000, 0, 2, 500000},
+		{26000000, 58000, 3, 3, 58035},
+		{26000000, 203000, 2, 0, 203125},
+		{26000000, 300000, 1, 1, 325000},
+		{26000000, 812000, 0, 0, 812500},
+	}
+	for _, c := range cases {
+		e, m := channelBandwidthToRegisters(c.bw, c.fxosc)
+		if e != c.e || m != c.m {
+			t.Errorf("channelBandwidthToRegisters(%d, %d) == (%d, %d), want (%d, %d)", c.bw, c.fxosc, e, m, c.e, c.m)
+		}
+		bw := registersToChannelBandwidth(c.e, c.m, c.fxosc)
+		if bw != c.achieved {
+			t.Errorf("registersToChannelBandwidth(%d, %d, %d) == %d, want %d", c.e, c.m, c.fxosc, bw, c.achieved)
+		}
+	}
+}
+
+func TestChannelSpacing(t *testing.T) {
+	cases := []struct {
+		fxosc    uint32
+		spacing  uint32
+		e, m     byte
+		achieved uint32
+	}{
+		{24000000, 25000, 0, 17, 24993},
+		{24000000, 50000, 1, 17, 49987},
+		{24000000, 103271, 2, 26, 103271},
+		{24000000, 200000, 3, 17, 199951},
+		{26000000, 25000, 0, 0, 25390},
+		{26000000, 50000, 0, 248, 49987},
+		{26000000, 103271, 2, 4, 103149},
+		{26000000, 350000, 3, 185, 349914},
+	}
+	for _, c := range cases {
+		e, m := channelSpacingToRegisters(c.spacing, c.fxosc)
+		if e != c.e || m != c.m {
+			t.Errorf("channelSpacingToRegisters(%d, %d) == (%d, %d), want (%d, %d)", c.spacing, c.fxosc, e, m, c.e, c.m)
+		}
+		spacing := registersToChannelSpacing(c.e, c.m, c.fxosc)
+		if spacing != c.achieved {
+			t.Errorf("registersToChannelSpacing(%d, %d, %d) == %d, want %d", c.e, c.m, c.fxosc, spacing, c.achieved)
+		}
+	}
+}
+
+func TestModemSetters(t *testing.T) {
+	r, _ := openEmulator(t)
+	r.InitRF(916600000)
+	if baud := r.SetDataRate(38400); baud != 38360 {
+		t.Errorf("SetDataRate(38400) == %d, want 38360", baud)
+	}
+	if bw := r.SetChannelBandwidth(100000); bw != 93750 {
+		t.Errorf("SetChannelBandwidth(100000) == %d, want 93750", bw)
+	}
+	if spacing := r.SetChannelSpacing(200000); spacing != 199951 {
+		t.Errorf("SetChannelSpacing(200000) == %d, want 199951", spacing)
+	}
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	bw, baud := r.ReadChannelParams()
+	fec, minPreamble, spacing := r.ReadModemConfig()
+	if bw != 93750 || baud != 38360 || spacing != 199951 {
+		t.Errorf("read back (%d, %d, %d), want (93750, 38360, 199951)", bw, baud, spacing)
+	}
+	// Fields sharing the modified registers must be preserved.
+	if fec || minPreamble != 24 {
+		t.Errorf("FEC, preamble == (%v, %d), want (false, 24)", fec, minPreamble)
+	}
+	if r.SetDataRate(200000) != 199951 {
+		t.Errorf("SetDataRate(200000) did not achieve 199951 Baud")
+	}
+	rf := r.ReadConfiguration()
+	if rf.TEST2 != TEST2_NORMAL_MAGIC || rf.TEST1 != TEST1_TX_MAGIC {
+		t.Errorf("TEST2, TEST1 == %02X %02X at high data rate, want normal values", rf.TEST2, rf.TEST1)
+	}
+
+	invalid := []func() uint32{
+		func() uint32 { return r.SetDataRate(10) },
+		func() uint32 { return r.SetDataRate(2000000) },
+		func() uint32 { return r.SetChannelBandwidth(50000) },
+		func() uint32 { return r.SetChannelBandwidth(1000000) },
+		func() uint32 { return r.SetChannelSpacing(20000) },
+		func() uint32 { return r.SetChannelSpacing(400000) },
+		// Representable, but outside the data sheet limits.
+		func() uint32 { return r.SetDataRate(300) },
+		func() uint32 { return r.SetDataRate(300000) },
+		func() uint32 { return r.SetChannelBandwidth(55000) },
+		func() uint32 { return r.SetChannelSpacing(24000) },
+	}
+	for i, f := range invalid {
+		r.SetError(nil)
+		v := f()
+		if _, ok := r.Error().(RangeError); !ok || v != 0 {
+			t.Errorf("invalid case %d: result %d, error %v, want RangeError", i, v, r.Error())
+		}
+	}
+
+	// The data rate limit depends on the modulation format.
+	r.SetError(nil)
+	r.SetModulation(Modulation2FSK, 47607)
+	if baud := r.SetDataRate(300000); baud == 0 || r.Error() != nil {
+		t.Errorf("SetDataRate(300000) with 2-FSK == %d, error %v", baud, r.Error())
+	}
+}
@@ -0,0 +1,71 @@
+package cc1101
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotReady indicates that the radio's crystal oscillator
+// did not stabilize after waking up from SLEEP state.
+var ErrNotReady = errors.New("radio not ready after wake-up")
+
+// Maximum time to wait for CHIP_RDY after waking up.
+const wakeTimeout = 10 * time.Millisecond
+
+// Sleep puts the radio into SLEEP (power-down) state.
+// The TEST registers and PATABLE are not retained in SLEEP state,
+// so Sleep saves a shadow copy of the configuration and PATABLE.
+// The next method called on the radio brings it out of SLEEP state
+// and restores them before doing anything else.
+func (r *Radio) Sleep() {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return
+	}
+	r.changeState(SIDLE, STATE_IDLE)
+	config := r.readConfiguration()
+	pa := r.readPATable()
+	if r.error() != nil {
+		return
+	}
+	r.shadow = *config
+	r.shadowPATable = append(r.shadowPATable[:0], pa...)
+	r.strobe(SPWD)
+	r.sleeping = true
+}
+
+// Wake brings the radio out of SLEEP state, waits for the crystal
+// oscillator to stabilize, and restores the PATABLE and TEST registers
+// saved by Sleep, leaving the radio in IDLE state.
+// Other methods wake the radio in the same way,
+// so Wake is only needed to wake it in advance.
+func (r *Radio) Wake() {
+	r.hold()
+	r.release()
+}
+
+// wake is called whenever the radio is held. If Sleep has put
+// the radio into SLEEP state, wake brings it out and restores
+// the lost registers.
+func (r *Radio) wake() {
+	if !r.sleeping {
+		return
+	}
+	// Pulling CSn low starts the crystal oscillator;
+	// the chip is ready when CHIP_RDY goes low.
+	deadline := time.Now().Add(wakeTimeout)
+	for r.strobe(SNOP)&CHIP_RDY != 0 && r.error() == nil {
+		if time.Now().After(deadline) {
+			r.setError(ErrNotReady)
+			return
+		}
+	}
+	if r.error() != nil {
+		return
+	}
+	r.sleeping = false
+	regs := r.shadow.Bytes()
+	r.hw.WriteBurst(FSTEST, regs[FSTEST:TEST0+1])
+	r.hw.WriteBurst(PATABLE, r.shadowPATable)
+}
@@ -0,0 +1,68 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSleepWake(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(916500000)
+	r.SetModulation(ModulationOOK, 0)
+	r.SetTxPower(5)
+	r.SetDataRate(250000)
+	before := *r.ReadConfiguration()
+	pa := r.ReadPATable()
+	r.Sleep()
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	r.Wake()
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if rf := e.Configuration(); rf != before {
+		t.Errorf("configuration after Wake == %+v, want %+v", rf, before)
+	}
+	if after := r.ReadPATable(); !bytes.Equal(after, pa) {
+		t.Errorf("PATABLE after Wake == % X, want % X", after, pa)
+	}
+	if s := r.ReadState(); s != STATE_IDLE {
+		t.Errorf("state after Wake == %s, want IDLE", StateName(s))
+	}
+
+	// Other methods wake the radio and restore the registers too.
+	r.Sleep()
+	if s := r.ReadState(); s != STATE_IDLE {
+		t.Errorf("state after sleeping == %s, want IDLE", StateName(s))
+	}
+	if rf := e.Configuration(); rf != before {
+		t.Errorf("configuration after ReadState == %+v, want %+v", rf, before)
+	}
+	if after := r.ReadPATable(); !bytes.Equal(after, pa) {
+		t.Errorf("PATABLE after ReadState == % X, want % X", after, pa)
+	}
+}
+
+func TestSendAfterWake(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(VariableLength, 61, true)
+	for _, wake := range []bool{true, false} {
+		r.Sleep()
+		time.Sleep(time.Millisecond)
+		if wake {
+			r.Wake()
+		}
+		data := binaryPacket(20)
+		r.Send(data)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		want := append([]byte{byte(len(data))}, data...)
+		if sent := e.Transmitted(); len(sent) != 1 || !bytes.Equal(sent[0], want) {
+			t.Errorf("Wake called: %v: transmitted % X, want % X", wake, sent, want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package cc1101
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamStats contains the counters maintained by a Stream.
+type StreamStats struct {
+	Received  uint64 // packets delivered on the channel
+	Dropped   uint64 // packets dropped because the channel was full
+	Invalid   uint64 // packets discarded because of CRC or length errors
+	Overflows uint64 // RXFIFO overflows
+}
+
+// Stream receives packets continuously, without leaving RX state
+// between packets, and delivers them on a channel.
+type Stream struct {
+	// The counters are accessed atomically, so they must be
+	// 64-bit aligned; see the sync/atomic documentation.
+	stats StreamStats
+
+	r       *Radio
+	packets chan Packet
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	err     error
+	buf     []byte    // incomplete packet
+	start   time.Time // when the incomplete packet was first seen
+}
+
+// GDO configuration used while streaming: asserted when the RXFIFO
+// is filled at or above the threshold or the end of packet is reached,
+// de-asserted when the RXFIFO is empty.
+const gdoRXFIFOThresholdOrEnd = 0x01
+
+// StartStream starts receiving packets continuously in a new goroutine,
+// using MCSM1.RXOFF_MODE to stay in RX state after each packet
+// and the GDO0 interrupt to read the RXFIFO as it fills.
+// Packets are delivered on a channel with the given buffer size;
+// if the channel is full, packets are dropped and counted.
+// Streaming requires the FixedLength or VariableLength packet format.
+// The stream holds the radio until Stop returns:
+// other operations wait for it, and ReadStatus returns ErrBusy.
+// If the stream cannot be started, StartStream sets the error state
+// and returns nil.
+func (r *Radio) StartStream(bufferSize int) *Stream {
+	r.holdLong()
+	if r.error() != nil {
+		r.release()
+		return nil
+	}
+	if r.packetFormat == ZeroTerminated || r.packetFormat == ExtendedLength {
+		r.setError(fmt.Errorf("streaming is not supported for %v packets", r.packetFormat))
+		r.release()
+		return nil
+	}
+	s := &Stream{
+		r:       r,
+		packets: make(chan Packet, bufferSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Packets returns the channel on which packets are delivered.
+// It is closed when the stream stops.
+func (s *Stream) Packets() <-chan Packet {
+	return s.packets
+}
+
+// Stats returns the stream's counters.
+func (s *Stream) Stats() StreamStats {
+	return StreamStats{
+		Received:  atomic.LoadUint64(&s.stats.Received),
+		Dropped:   atomic.LoadUint64(&s.stats.Dropped),
+		Invalid:   atomic.LoadUint64(&s.stats.Invalid),
+		Overflows: atomic.LoadUint64(&s.stats.Overflows),
+	}
+}
+
+// Stop stops the stream and waits for its goroutine to finish,
+// leaving the radio in IDLE state with its previous configuration.
+// It returns the error, if any, that stopped the stream.
+func (s *Stream) Stop() error {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+	return s.err
+}
+
+func (s *Stream) run() {
+	defer close(s.done)
+	defer close(s.packets)
+	r := s.r
+	defer r.release()
+	r.changeState(SIDLE, STATE_IDLE)
+	r.strobe(SFRX)
+	iocfg0 := r.hw.ReadRegister(IOCFG0)
+	mcsm1 := r.hw.ReadRegister(MCSM1)
+	r.hw.WriteRegister(IOCFG0, gdoRXFIFOThresholdOrEnd)
+	r.hw.WriteRegister(MCSM1, mcsm1&^(3<<2)|MCSM1_RXOFF_MODE_RX)
+	r.changeState(SRX, STATE_RX)
+loop:
+	for r.error() == nil {
+		select {
+		case <-s.stop:
+			break loop
+		default:
+		}
+		r.hw.AwaitInterrupt(interruptPollTime)
+		if err := r.error(); err != nil {
+			if !isInterruptTimeout(err) {
+				break loop
+			}
+			r.setError(nil)
+		}
+		// Read the RXFIFO even without an interrupt, since it
+		// is not re-asserted if the RXFIFO was not emptied.
+		s.drain()
+	}
+	s.err = r.error()
+	r.stopRX()
+	r.hw.WriteRegister(IOCFG0, iocfg0)
+	r.hw.WriteRegister(MCSM1, mcsm1)
+	if s.err == nil {
+		s.err = r.error()
+	}
+}
+
+// drain reads the contents of the RXFIFO and delivers
+// any complete packets, keeping the bytes of an incomplete one.
+func (s *Stream) drain() {
+	r := s.r
+	for r.error() == nil {
+		numBytes := int(r.readNumRXBytes())
+		if r.error() == ErrRXFIFOOverflow {
+			atomic.AddUint64(&s.stats.Overflows, 1)
+			s.restart()
+			return
+		}
+		if numBytes == 0 {
+			return
+		}
+		if len(s.buf) == 0 {
+			s.start = time.Now()
+		}
+		total := s.frameSize()
+		if total < 0 {
+			atomic.AddUint64(&s.stats.Invalid, 1)
+			s.restart()
+			return
+		}
+		// Don't read last byte of FIFO if packet is still
+		// being received. See Section 20 of data sheet.
+		// The RXFIFO may also contain the start of the next packet.
+		n := numBytes - 1
+		switch {
+		case total == 0:
+			// Read the length byte first.
+			if n > 1 {
+				n = 1
+			}
+		case numBytes >= total-len(s.buf):
+			n = total - len(s.buf)
+		}
+		if n < 1 {
+			return
+		}
+		data := r.hw.ReadBurst(RXFIFO, n)
+		if r.error() != nil {
+			return
+		}
+		s.buf = append(s.buf, data...)
+		if len(s.buf) == total {
+			s.deliver()
+		}
+	}
+}
+
+// frameSize returns the number of bytes in the RXFIFO,
+// including the appended status bytes, for the packet in s.buf,
+// 0 if it is not yet known, or -1 if the length byte is invalid.
+func (s *Stream) frameSize() int {
+	r := s.r
+	if r.packetFormat == FixedLength {
+		return r.packetLength + numStatusBytes
+	}
+	if len(s.buf) == 0 {
+		return 0
+	}
+	n := int(s.buf[0])
+	if n > r.packetLength {
+		return -1
+	}
+	return 1 + n + numStatusBytes
+}
+
+// deliver decodes the complete packet in s.buf
+// and sends it on the channel if there is room.
+func (s *Stream) deliver() {
+	r := s.r
+	p, ok := r.decodePacket(s.buf)
+	s.buf = s.buf[:0]
+	if !ok {
+		atomic.AddUint64(&s.stats.Invalid, 1)
+		return
+	}
+	p.Time = s.start
+	r.readPacketInfo(&p)
+	select {
+	case s.packets <- p:
+		atomic.AddUint64(&s.stats.Received, 1)
+	default:
+		atomic.AddUint64(&s.stats.Dropped, 1)
+	}
+}
+
+// restart discards the contents of the RXFIFO and re-enters RX state.
+func (s *Stream) restart() {
+	s.buf = s.buf[:0]
+	s.r.stopRX()
+	s.r.changeState(SRX, STATE_RX)
+}
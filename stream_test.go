@@ -0,0 +1,100 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// waitForStats waits until the stream has processed n packets.
+func waitForStats(t *testing.T, s *Stream, n uint64) StreamStats {
+	deadline := time.Now().Add(time.Second)
+	for {
+		st := s.Stats()
+		if st.Received+st.Dropped+st.Invalid+st.Overflows >= n {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for stream: %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStream(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	if s := r.StartStream(10); s != nil || r.Error() == nil {
+		t.Errorf("StartStream with %v packets succeeded, want error", ZeroTerminated)
+	}
+	r.SetError(nil)
+	r.SetPacketFormat(VariableLength, 61, true)
+	before := e.Configuration()
+	s := r.StartStream(10)
+	if s == nil {
+		t.Fatal(r.Error())
+	}
+	var sent [][]byte
+	for i := 0; i < 5; i++ {
+		data := binaryPacket(10 + 10*i)
+		sent = append(sent, data)
+		e.Inject(append([]byte{byte(len(data))}, data...))
+	}
+	for i, data := range sent {
+		select {
+		case p := <-s.Packets():
+			if !bytes.Equal(p.Data, data) {
+				t.Errorf("packet %d == % X, want % X", i, p.Data, data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for packet %d: %+v", i, s.Stats())
+		}
+	}
+	if st := e.State(); st != STATE_RX {
+		t.Errorf("state while streaming == %s, want RX", StateName(st))
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-s.Packets(); ok {
+		t.Errorf("packet channel not closed after Stop")
+	}
+	if st := s.Stats(); st != (StreamStats{Received: 5}) {
+		t.Errorf("stats == %+v, want 5 received", st)
+	}
+	if st := e.State(); st != STATE_IDLE {
+		t.Errorf("state after Stop == %s, want IDLE", StateName(st))
+	}
+	if rf := e.Configuration(); rf != before {
+		t.Errorf("configuration after Stop == %+v, want %+v", rf, before)
+	}
+}
+
+func TestStreamCounters(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.SetPacketFormat(FixedLength, 20, true)
+	s := r.StartStream(1)
+	data := binaryPacket(20)
+	for i := 0; i < 3; i++ {
+		e.Inject(data)
+	}
+	st := waitForStats(t, s, 3)
+	if st.Received != 1 || st.Dropped != 2 {
+		t.Errorf("stats == %+v, want 1 received, 2 dropped", st)
+	}
+	<-s.Packets()
+	e.InjectCorrupted(data)
+	e.InjectOverflow()
+	e.Inject(data)
+	st = waitForStats(t, s, 6)
+	if st != (StreamStats{Received: 2, Dropped: 2, Invalid: 1, Overflows: 1}) {
+		t.Errorf("stats == %+v, want 2 received, 2 dropped, 1 invalid, 1 overflow", st)
+	}
+	if p := <-s.Packets(); !bytes.Equal(p.Data, data) {
+		t.Errorf("received % X, want % X", p.Data, data)
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,151 @@
+package cc1101
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// WakeOnRadio describes the Wake-on-Radio timing set by SetWakeOnRadio.
+type WakeOnRadio struct {
+	Interval  time.Duration // time between wake-ups (Event 0 timeout)
+	RXTimeout time.Duration // time spent in RX searching for a sync word
+	DutyCycle float64       // fraction of time spent in RX
+}
+
+// Maximum RX_TIME value that specifies a timeout
+// (see table 31 of the data sheet).
+const maxRXTime = 6
+
+// Time to allow for the RC oscillator to be calibrated
+// while the crystal oscillator is running.
+const rcCalibrationTime = 2 * time.Millisecond
+
+// worUnit returns the Event 0 resolution for the given WOR_RES value.
+func worUnit(res byte, fxosc uint32) time.Duration {
+	return time.Duration(float64(uint64(750)<<(5*res)) * float64(time.Second) / float64(fxosc))
+}
+
+// worRXFraction returns the RX timeout as a fraction of the Event 0 timeout
+// for the given RX_TIME and WOR_RES values (see section 19.5 of the data sheet).
+func worRXFraction(rxTime, res byte) float64 {
+	return float64(1+4*res) / float64(uint64(1)<<(rxTime+3+5*res))
+}
+
+// worToRegisters returns the EVENT0, WOR_RES and RX_TIME values
+// that best achieve the given wake-up interval and RX timeout,
+// minimizing the sum of their relative errors.
+func worToRegisters(interval, rxTimeout time.Duration, fxosc uint32) (uint16, byte, byte, error) {
+	if interval <= 0 || rxTimeout <= 0 || rxTimeout >= interval {
+		return 0, 0, 0, fmt.Errorf("invalid interval %v with RX timeout %v for Wake-on-Radio", interval, rxTimeout)
+	}
+	bestErr := math.Inf(1)
+	event0, bestRes, bestRX := uint16(0), byte(0), byte(0)
+	for res := byte(0); res < 4; res++ {
+		unit := worUnit(res, fxosc)
+		n := (interval + unit/2) / unit
+		if n < 1 || n > math.MaxUint16 {
+			continue
+		}
+		t := n * unit
+		for rx := byte(0); rx <= maxRXTime; rx++ {
+			rt := time.Duration(float64(t) * worRXFraction(rx, res))
+			e := math.Abs(float64(t-interval))/float64(interval) +
+				math.Abs(float64(rt-rxTimeout))/float64(rxTimeout)
+			if e < bestErr {
+				bestErr = e
+				event0, bestRes, bestRX = uint16(n), res, rx
+			}
+		}
+	}
+	if event0 == 0 {
+		return 0, 0, 0, fmt.Errorf("interval %v is out of range for Wake-on-Radio", interval)
+	}
+	return event0, bestRes, bestRX, nil
+}
+
+// registersToWOR returns the Wake-on-Radio timing for the given register values.
+func registersToWOR(event0 uint16, res, rxTime byte, fxosc uint32) WakeOnRadio {
+	t := time.Duration(event0) * worUnit(res, fxosc)
+	f := worRXFraction(rxTime, res)
+	return WakeOnRadio{
+		Interval:  t,
+		RXTimeout: time.Duration(float64(t) * f),
+		DutyCycle: f,
+	}
+}
+
+// SetWakeOnRadio configures the radio to wake up at the given interval
+// and listen for a sync word for the given RX timeout, and calibrates
+// the RC oscillator that times the sleep periods.
+// It returns the achieved timing. The duty cycle does not include
+// the crystal oscillator start-up and synthesizer calibration time.
+// Use ReceiveWakeOnRadio to receive packets in Wake-on-Radio mode.
+// InitRF disables Wake-on-Radio.
+func (r *Radio) SetWakeOnRadio(interval, rxTimeout time.Duration) WakeOnRadio {
+	r.hold()
+	defer r.release()
+	if r.error() != nil {
+		return WakeOnRadio{}
+	}
+	event0, res, rxTime, err := worToRegisters(interval, rxTimeout, r.fxosc)
+	if err != nil {
+		r.setError(err)
+		return WakeOnRadio{}
+	}
+	r.changeState(SIDLE, STATE_IDLE)
+	r.hw.WriteBurst(WOREVT1, []byte{
+		byte(event0 >> 8),
+		byte(event0),
+		7<<WORCTRL_EVENT1_SHIFT | WORCTRL_RC_CAL | res<<WORCTRL_WOR_RES_SHIFT,
+	})
+	// The RC oscillator is calibrated while the crystal oscillator is running.
+	time.Sleep(rcCalibrationTime)
+	if r.error() != nil {
+		return WakeOnRadio{}
+	}
+	r.worRXTime = rxTime
+	r.wor = registersToWOR(event0, res, rxTime, r.fxosc)
+	return r.wor
+}
+
+// ReceiveWakeOnRadio puts the radio into Wake-on-Radio mode
+// and waits with the given timeout for an incoming packet.
+// It returns the packet and its metadata, as for ReceivePacket,
+// and leaves the radio in IDLE state.
+func (r *Radio) ReceiveWakeOnRadio(timeout time.Duration) Packet {
+	r.holdLong()
+	defer r.release()
+	if r.error() != nil {
+		return Packet{}
+	}
+	if r.wor.Interval == 0 {
+		r.setError(fmt.Errorf("SetWakeOnRadio has not been called"))
+		return Packet{}
+	}
+	// RX_TIME also applies to normal RX, so only set it
+	// while in Wake-on-Radio mode.
+	m2 := r.hw.ReadRegister(MCSM2)
+	r.hw.WriteRegister(MCSM2, m2&^MCSM2_RX_TIME_MASK|r.worRXTime<<MCSM2_RX_TIME_SHIFT)
+	p := r.receivePacket(timeout, true)
+	err := r.error()
+	r.hw.WriteRegister(MCSM2, m2)
+	if err != nil {
+		r.setError(err)
+	}
+	return p
+}
+
+// listen puts the radio into RX state, or into Wake-on-Radio mode if wor is true.
+// In Wake-on-Radio mode, the radio must not be accessed until
+// the receive interrupt occurs, since any SPI access would
+// bring it out of SLEEP state and end the polling sequence.
+func (r *Radio) listen(wor bool) {
+	if !wor {
+		r.changeState(SRX, STATE_RX)
+		return
+	}
+	r.changeState(SIDLE, STATE_IDLE)
+	r.strobe(SWORRST)
+	r.strobe(SWOR)
+}
@@ -0,0 +1,87 @@
+package cc1101
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWakeOnRadioRegisters(t *testing.T) {
+	cases := []struct {
+		interval  time.Duration
+		rxTimeout time.Duration
+		event0    uint16
+		res       byte
+		rxTime    byte
+		wor       WakeOnRadio
+	}{
+		{time.Second, 2 * time.Millisecond, 32000, 0, 6, WakeOnRadio{time.Second, 1953125 * time.Nanosecond, 1.0 / 512}},
+		{10 * time.Second, 3 * time.Millisecond, 10000, 1, 6, WakeOnRadio{10 * time.Second, 3051757 * time.Nanosecond, 5.0 / 16384}},
+		{100 * time.Millisecond, 12500 * time.Microsecond, 3200, 0, 0, WakeOnRadio{100 * time.Millisecond, 12500 * time.Microsecond, 1.0 / 8}},
+	}
+	r, e := openEmulator(t)
+	for _, c := range cases {
+		r.InitRF(868300000)
+		wor := r.SetWakeOnRadio(c.interval, c.rxTimeout)
+		if r.Error() != nil {
+			t.Fatal(r.Error())
+		}
+		if wor != c.wor {
+			t.Errorf("SetWakeOnRadio(%v, %v) == %+v, want %+v", c.interval, c.rxTimeout, wor, c.wor)
+		}
+		rf := e.Configuration()
+		event0 := uint16(rf.WOREVT1)<<8 | uint16(rf.WOREVT0)
+		worctrl := byte(7<<WORCTRL_EVENT1_SHIFT | WORCTRL_RC_CAL | c.res)
+		if event0 != c.event0 || rf.WORCTRL != worctrl {
+			t.Errorf("SetWakeOnRadio(%v, %v): EVENT0, WORCTRL == %d %02X, want %d %02X",
+				c.interval, c.rxTimeout, event0, rf.WORCTRL, c.event0, worctrl)
+		}
+		if r.worRXTime != c.rxTime {
+			t.Errorf("SetWakeOnRadio(%v, %v): RX_TIME == %d, want %d", c.interval, c.rxTimeout, r.worRXTime, c.rxTime)
+		}
+	}
+	invalid := [][2]time.Duration{
+		{0, time.Millisecond},
+		{time.Second, 0},
+		{time.Millisecond, time.Second},
+		{24 * time.Hour, time.Second},
+	}
+	for _, c := range invalid {
+		r.SetError(nil)
+		r.SetWakeOnRadio(c[0], c[1])
+		if r.Error() == nil {
+			t.Errorf("SetWakeOnRadio(%v, %v) succeeded, want error", c[0], c[1])
+		}
+	}
+}
+
+func TestReceiveWakeOnRadio(t *testing.T) {
+	r, e := openEmulator(t)
+	r.InitRF(868300000)
+	r.ReceiveWakeOnRadio(time.Millisecond)
+	if r.Error() == nil {
+		t.Errorf("ReceiveWakeOnRadio without SetWakeOnRadio succeeded, want error")
+	}
+	r.SetError(nil)
+	r.SetPacketFormat(VariableLength, 61, true)
+	r.SetWakeOnRadio(time.Second, 2*time.Millisecond)
+	data := binaryPacket(20)
+	e.Inject(append([]byte{byte(len(data))}, data...))
+	p := r.ReceiveWakeOnRadio(time.Second)
+	if r.Error() != nil {
+		t.Fatal(r.Error())
+	}
+	if !bytes.Equal(p.Data, data) {
+		t.Errorf("received % X, want % X", p.Data, data)
+	}
+	if m2 := e.Configuration().MCSM2; m2 != MCSM2_RX_TIME_END_OF_PACKET {
+		t.Errorf("MCSM2 after ReceiveWakeOnRadio == %02X, want %02X", m2, MCSM2_RX_TIME_END_OF_PACKET)
+	}
+	if s := r.ReadState(); s != STATE_IDLE {
+		t.Errorf("state after ReceiveWakeOnRadio == %s, want IDLE", StateName(s))
+	}
+	p = r.ReceiveWakeOnRadio(10 * time.Millisecond)
+	if p.Data != nil {
+		t.Errorf("received % X with no packet sent", p.Data)
+	}
+}